@@ -21,7 +21,8 @@ func main() {
 
 	log.Printf("last candle: %#v\n", candle)
 
-	now := time.Now()
+	// server time, the clock is synchronized by the Date header of the response above
+	now := c.Clock().Now()
 	millis := now.UnixNano() / 1000000
 
 	prior := now.Add(time.Duration(-24) * time.Hour)
@@ -9,9 +9,17 @@ import (
 func F64Slice(in []interface{}) ([]float64, error) {
 	var ret []float64
 	for _, e := range in {
-		if item, ok := e.(float64); ok {
+		switch item := e.(type) {
+		case float64:
 			ret = append(ret, item)
-		} else {
+		case string:
+			// decimals are sent as strings with the DEC_S flag
+			f, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected slice of float64 but got: %v", in)
+			}
+			ret = append(ret, f)
+		default:
 			return nil, fmt.Errorf("expected slice of float64 but got: %v", in)
 		}
 	}
@@ -78,8 +86,12 @@ func ToFloat64Array(i [][]interface{}) ([][]float64, error) {
 }
 
 func FloatToJsonNumber(i interface{}) json.Number {
-	if r, ok := i.(json.Number); ok {
+	switch r := i.(type) {
+	case json.Number:
 		return r
+	case string:
+		// decimals are sent as strings with the DEC_S flag
+		return json.Number(r)
 	}
 	return json.Number(strconv.FormatFloat(i.(float64), 'f', -1, 64))
 }
@@ -99,8 +111,14 @@ func IValOrZero(i interface{}) int {
 }
 
 func F64ValOrZero(i interface{}) float64 {
-	if r, ok := i.(float64); ok {
+	switch r := i.(type) {
+	case float64:
 		return r
+	case string:
+		// decimals are sent as strings with the DEC_S flag
+		if f, err := strconv.ParseFloat(r, 64); err == nil {
+			return f
+		}
 	}
 	return 0.0
 }
@@ -1,6 +1,7 @@
 package convert_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/bitfinexcom/bitfinex-api-go/pkg/convert"
@@ -61,3 +62,44 @@ func TestToInt(t *testing.T) {
 		assert.Equal(t, expected, got)
 	})
 }
+
+func TestF64ValOrZero(t *testing.T) {
+	t.Run("float64", func(t *testing.T) {
+		got := convert.F64ValOrZero(12.5)
+		assert.Equal(t, 12.5, got)
+	})
+
+	t.Run("decimal string", func(t *testing.T) {
+		got := convert.F64ValOrZero("0.00012")
+		assert.Equal(t, 0.00012, got)
+	})
+
+	t.Run("invalid string", func(t *testing.T) {
+		got := convert.F64ValOrZero("foo")
+		assert.Equal(t, 0.0, got)
+	})
+}
+
+func TestF64Slice(t *testing.T) {
+	t.Run("mixed floats and decimal strings", func(t *testing.T) {
+		got, err := convert.F64Slice([]interface{}{7000.5, "1", "-0.25"})
+		require.Nil(t, err)
+		assert.Equal(t, []float64{7000.5, 1, -0.25}, got)
+	})
+
+	t.Run("invalid string", func(t *testing.T) {
+		got, err := convert.F64Slice([]interface{}{7000.5, "foo"})
+		require.NotNil(t, err)
+		require.Nil(t, got)
+	})
+}
+
+func TestFloatToJsonNumber(t *testing.T) {
+	t.Run("float64", func(t *testing.T) {
+		assert.Equal(t, json.Number("0.1"), convert.FloatToJsonNumber(0.1))
+	})
+
+	t.Run("decimal string", func(t *testing.T) {
+		assert.Equal(t, json.Number("0.10"), convert.FloatToJsonNumber("0.10"))
+	})
+}
@@ -29,6 +29,10 @@ type listener struct {
 	funding              chan *bitfinex.FundingInfo
 	orderNew             chan *bitfinex.OrderNew
 	orderUpdate          chan *bitfinex.OrderUpdate
+	lifecycleEvents      chan interface{}
+	checksumMismatches   chan *websocket.ChecksumMismatch
+	sequenceGaps         chan *websocket.SequenceGap
+	pongEvents           chan *websocket.PongEvent
 	errors               chan error
 }
 
@@ -54,6 +58,10 @@ func newListener() *listener {
 		orderNew:             make(chan *bitfinex.OrderNew, 10),
 		orderUpdate:          make(chan *bitfinex.OrderUpdate, 10),
 		funding:              make(chan *bitfinex.FundingInfo, 10),
+		lifecycleEvents:      make(chan interface{}, 100), // one event per reconnect attempt
+		checksumMismatches:   make(chan *websocket.ChecksumMismatch, 10),
+		sequenceGaps:         make(chan *websocket.SequenceGap, 10),
+		pongEvents:           make(chan *websocket.PongEvent, 10),
 	}
 }
 
@@ -323,6 +331,62 @@ func (l *listener) nextOrderUpdate() (*bitfinex.OrderUpdate, error) {
 	}
 }
 
+func (l *listener) nextChecksumMismatch() (*websocket.ChecksumMismatch, error) {
+	timeout := make(chan bool)
+	go func() {
+		time.Sleep(time.Second * 2)
+		close(timeout)
+	}()
+	select {
+	case ev := <-l.checksumMismatches:
+		return ev, nil
+	case <-timeout:
+		return nil, errors.New("timed out waiting for ChecksumMismatch")
+	}
+}
+
+func (l *listener) nextSequenceGap() (*websocket.SequenceGap, error) {
+	timeout := make(chan bool)
+	go func() {
+		time.Sleep(time.Second * 2)
+		close(timeout)
+	}()
+	select {
+	case ev := <-l.sequenceGaps:
+		return ev, nil
+	case <-timeout:
+		return nil, errors.New("timed out waiting for SequenceGap")
+	}
+}
+
+func (l *listener) nextPongEvent() (*websocket.PongEvent, error) {
+	timeout := make(chan bool)
+	go func() {
+		time.Sleep(time.Second * 2)
+		close(timeout)
+	}()
+	select {
+	case ev := <-l.pongEvents:
+		return ev, nil
+	case <-timeout:
+		return nil, errors.New("timed out waiting for PongEvent")
+	}
+}
+
+func (l *listener) nextLifecycleEvent() (interface{}, error) {
+	timeout := make(chan bool)
+	go func() {
+		time.Sleep(time.Second * 2)
+		close(timeout)
+	}()
+	select {
+	case ev := <-l.lifecycleEvents:
+		return ev, nil
+	case <-timeout:
+		return nil, errors.New("timed out waiting for lifecycle event")
+	}
+}
+
 // strongly types messages and places them into a channel
 func (l *listener) run(ch <-chan interface{}) {
 	go func() {
@@ -376,6 +440,16 @@ func (l *listener) run(ch <-chan interface{}) {
 					l.positionSnapshot <- msg.(*bitfinex.PositionSnapshot)
 				case *bitfinex.WalletSnapshot:
 					l.walletSnapshot <- msg.(*bitfinex.WalletSnapshot)
+				case *websocket.SocketConnected, *websocket.SocketDisconnected, *websocket.Reconnecting,
+					*websocket.ReconnectFailed, *websocket.Resubscribed, *websocket.MaintenanceStarted, *websocket.MaintenanceEnded,
+					*websocket.ConnectionThrottled, *websocket.SubscribeProgress, *websocket.HeartbeatRecovery:
+					l.lifecycleEvents <- msg
+				case *websocket.ChecksumMismatch:
+					l.checksumMismatches <- msg.(*websocket.ChecksumMismatch)
+				case *websocket.SequenceGap:
+					l.sequenceGaps <- msg.(*websocket.SequenceGap)
+				case *websocket.PongEvent:
+					l.pongEvents <- msg.(*websocket.PongEvent)
 				default:
 					log.Printf("COULD NOT TYPE MSG ^")
 				}
@@ -13,18 +13,34 @@ import (
 
 // does not work for reconnect tests
 type TestAsyncFactory struct {
-	Count int
-	Async websocket.Asynchronous
+	Count   int
+	Async   websocket.Asynchronous
+	created []*TestAsync
+	mutex   sync.Mutex
 }
 
 func (t *TestAsyncFactory) Create() websocket.Asynchronous {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.Count += 1
 	// if first creation then send given async
 	if t.Count == 1 {
 		return t.Async
 	}
 	// otherwise create a new async for each new creation
-	return newTestAsync()
+	async := newTestAsync()
+	t.created = append(t.created, async)
+	return async
+}
+
+// Created returns the n-th async created after the given one
+func (t *TestAsyncFactory) Created(n int) *TestAsync {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if n < len(t.created) {
+		return t.created[n]
+	}
+	return nil
 }
 
 func newTestAsyncFactory(async websocket.Asynchronous) websocket.AsynchronousFactory {
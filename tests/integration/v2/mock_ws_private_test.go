@@ -2,8 +2,10 @@ package tests
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/bitfinexcom/bitfinex-api-go/v2"
 	"github.com/bitfinexcom/bitfinex-api-go/v2/websocket"
@@ -636,5 +638,971 @@ func TestUsesAuthenticatedSocket(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	fmt.Println(*authSocket)
+	fmt.Println(authSocket.Id)
+}
+
+func TestSubmitOrderAndWait(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	_, err := listener.nextInfoEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	_, err = listener.nextAuthEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// orders without a CID can not be matched
+	_, err = ws.SubmitOrderAndWait(context.Background(), &bitfinex.OrderNewRequest{Symbol: "tBTCUSD", Amount: 1})
+	if err != websocket.ErrMissingCID {
+		t.Fatalf("expected ErrMissingCID but got %#v", err)
+	}
+
+	// submit order and wait for the notification
+	type orderResult struct {
+		order *bitfinex.OrderNew
+		err   error
+	}
+	results := make(chan orderResult)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		on, err := ws.SubmitOrderAndWait(ctx, &bitfinex.OrderNewRequest{Symbol: "tBTCUSD", CID: 123, Amount: 1, Type: "MARKET"})
+		results <- orderResult{order: on, err: err}
+	}()
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	// unrelated order ack is not matched
+	async.Publish(`[0,"n",[null,"on-req",null,null,[7654321,null,456,"tBTCUSD",null,null,1,1,"MARKET",null,null,null,null,null,null,null,915.5,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitting market buy order for 1.0 BTC."]]`)
+	async.Publish(`[0,"n",[null,"on-req",null,null,[1234567,null,123,"tBTCUSD",null,null,1,1,"MARKET",null,null,null,null,null,null,null,915.5,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitting market buy order for 1.0 BTC."]]`)
+	res := <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	assert(t, int64(1234567), res.order.ID)
+	assert(t, int64(123), res.order.CID)
+
+	// rejected cancel returns a typed error
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		_, err := ws.SubmitCancelAndWait(ctx, &bitfinex.OrderCancelRequest{ID: 1234567})
+		results <- orderResult{err: err}
+	}()
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[0,"n",[null,"oc-req",null,null,[1234567,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null,null,null,null],null,"ERROR","Order not found."]]`)
+	res = <-results
+	nErr, ok := res.err.(*websocket.NotificationError)
+	if !ok {
+		t.Fatalf("expected NotificationError but got %#v", res.err)
+	}
+	assert(t, "Order not found.", nErr.Notification.Text)
+
+	// a missing notification times out with the context
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_, err = ws.SubmitUpdateOrderAndWait(ctx, &bitfinex.OrderUpdateRequest{ID: 1234567, Price: 900})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context deadline but got %#v", err)
+	}
+}
+
+func TestOrderMultiOp(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	_, err := listener.nextInfoEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	_, err = listener.nextAuthEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replace a ladder in a single message
+	type multiResult struct {
+		notifications *bitfinex.NotificationSnapshot
+		orders        *bitfinex.OrderSnapshot
+		err           error
+	}
+	results := make(chan multiResult)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		ns, err := ws.SubmitOrderMultiOpAndWait(ctx, &bitfinex.OrderMultiOpRequest{Ops: []bitfinex.OrderOp{
+			&bitfinex.OrderMultiCancelRequest{GroupOrderIDs: []int64{7}},
+			&bitfinex.OrderNewRequest{GID: 7, CID: 123, Type: "EXCHANGE LIMIT", Symbol: "tBTCUSD", Amount: 1, Price: 900},
+			&bitfinex.OrderUpdateRequest{ID: 1234567, Price: 910},
+			&bitfinex.OrderCancelRequest{ID: 7654321},
+		}})
+		results <- multiResult{notifications: ns, err: err}
+	}()
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := json.Marshal(async.Sent[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0,"ox_multi",null,[["oc_multi",{"gid":[7]}],["on",{"gid":7,"cid":123,"type":"EXCHANGE LIMIT","symbol":"tBTCUSD","amount":"1","price":"900"}],["ou",{"id":1234567,"price":"910"}],["oc",{"id":7654321}]]]`, string(msg))
+	async.Publish(`[0,"n",[null,"ox_multi-req",null,null,[[null,"oc_multi-req",null,null,[],null,"SUCCESS","Submitted for cancellation."],[null,"on-req",null,null,[1234568,7,123,"tBTCUSD",null,null,1,1,"EXCHANGE LIMIT",null,null,null,null,null,null,null,900,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitting exchange limit buy order for 1.0 BTC."],[null,"ou-req",null,null,[1234567,null,100,"tBTCUSD",null,null,1,1,"EXCHANGE LIMIT",null,null,null,null,null,null,null,910,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitting update."],[null,"oc-req",null,null,[7654321,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null,null,null,null],null,"ERROR","Order not found."]],null,"SUCCESS","Submitting 4 operations."]]`)
+	res := <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	assert(t, 4, len(res.notifications.Snapshot))
+	assert(t, int64(123), res.notifications.Snapshot[1].NotifyInfo.(*bitfinex.OrderNew).CID)
+	assert(t, 910.0, res.notifications.Snapshot[2].NotifyInfo.(*bitfinex.OrderUpdate).Price)
+	assert(t, websocket.NotificationStatusError, res.notifications.Snapshot[3].Status)
+
+	// cancel all orders of the ladder
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		os, err := ws.SubmitCancelMultiAndWait(ctx, &bitfinex.OrderMultiCancelRequest{
+			OrderIDs:       []int64{1234567},
+			ClientOrderIDs: []bitfinex.ClientOrderID{{CID: 123, CIDDate: "2020-05-28"}},
+		})
+		results <- multiResult{orders: os, err: err}
+	}()
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = json.Marshal(async.Sent[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0,"oc_multi",null,{"id":[1234567],"cid":[[123,"2020-05-28"]]}]`, string(msg))
+	async.Publish(`[0,"n",[null,"oc_multi-req",null,null,[[1234567,null,100,"tBTCUSD",null,null,1,1,"EXCHANGE LIMIT",null,null,null,null,null,null,null,910,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null],[1234568,7,123,"tBTCUSD",null,null,1,1,"EXCHANGE LIMIT",null,null,null,null,null,null,null,900,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null]],null,"SUCCESS","Submitted for cancellation."]]`)
+	res = <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	assert(t, 2, len(res.orders.Snapshot))
+	assert(t, int64(1234568), res.orders.Snapshot[1].ID)
+
+	// cancel all orders
+	if err := ws.SubmitCancelMulti(context.Background(), &bitfinex.OrderMultiCancelRequest{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = json.Marshal(async.Sent[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0,"oc_multi",null,{"all":1}]`, string(msg))
+}
+
+func TestRequestCalc(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	_, err := listener.nextInfoEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	_, err = listener.nextAuthEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.RequestCalc(context.Background()); err != websocket.ErrEmptyCalc {
+		t.Fatalf("expected ErrEmptyCalc but got %#v", err)
+	}
+	err = ws.RequestCalc(context.Background(),
+		websocket.CalcMarginBase(),
+		websocket.CalcMarginSymbol("tBTCUSD"),
+		websocket.CalcPosition("tBTCUSD"),
+		websocket.CalcWallet("margin", "BTC"),
+		websocket.CalcFundingSymbol("fUSD"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := json.Marshal(async.Sent[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0,"calc",null,[["margin_base"],["margin_sym_tBTCUSD"],["position_tBTCUSD"],["wallet_margin_BTC"],["funding_sym_fUSD"]]]`, string(msg))
+
+	// results are delivered as balance updates
+	async.Publish(`[0,"miu",["base",[-13.014640000000007,0,49331.70267297,49318.68803297,27]]]`)
+	base, err := listener.nextMarginInfoBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 49331.70267297, base.MarginBalance)
+	async.Publish(`[0,"wu",["margin","BTC",10,0,10]]`)
+	wu, err := listener.nextWalletUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &bitfinex.WalletUpdate{Type: "margin", Currency: "BTC", Balance: 10, BalanceAvailable: 10}, wu)
+	async.Publish(`[0,"fiu",["sym","fUSD",[0.0008595462068208099,0,1.8444560185185187,0]]]`)
+	fi, err := listener.nextFundingInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "fUSD", fi.Symbol)
+}
+
+func TestAuthFilter(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).
+		Credentials("apiKeyABC", "apiSecretXYZ").
+		AuthFilter(websocket.FilterFunding, websocket.FilterWalletCurrency("funding", "USD"))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// auth request carries the filters
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	auth := async.Sent[0].(*websocket.SubscriptionRequest)
+	assert(t, 2, len(auth.Filter))
+	assert(t, "funding", auth.Filter[0])
+	assert(t, "wallet-funding-USD", auth.Filter[1])
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-authenticate with new filters on the live connection
+	if err := ws.Reauthenticate(context.Background(), websocket.FilterTradingSymbol("tBTCUSD")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := json.Marshal(async.Sent[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `{"event":"unauth"}`, string(msg))
+	async.Publish(`{"event":"unauth","status":"OK","chanId":0}`)
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	auth = async.Sent[2].(*websocket.SubscriptionRequest)
+	assert(t, "auth", auth.Event)
+	assert(t, "nonce2", auth.SubID)
+	assert(t, 1, len(auth.Filter))
+	assert(t, "trading-tBTCUSD", auth.Filter[0])
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce2","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.GetAuthenticatedSocket(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the authenticated socket re-opens (i.e. after a reconnect) with the new filters
+	async.Publish(`{"event":"info","version":2}`)
+	if err := async.waitForMessage(3); err != nil {
+		t.Fatal(err)
+	}
+	auth = async.Sent[3].(*websocket.SubscriptionRequest)
+	assert(t, 1, len(auth.Filter))
+	assert(t, "trading-tBTCUSD", auth.Filter[0])
+}
+
+func TestSequenceGap(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.SequenceGapPolicy = websocket.SequenceGapResync
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.EnableFlag(context.Background(), bitfinex.Seq_all); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + id + `","pair":"BTCUSD"}`)
+
+	// complete sequences
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454],1]`)
+	async.Publish(`[5,"hb",2]`)
+	async.Publish(`[0,"wu",["exchange","BTC",30,0,30],3,1]`)
+	async.Publish(`[0,"n",[null,"on-req",null,null,[1234567,null,123,"tBTCUSD",null,null,1,1,"MARKET",null,null,null,null,null,null,null,915.5,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitting market buy order for 1.0 BTC."],2]`)
+	async.Publish(`[0,"wu",["exchange","BTC",31,0,31],4,3]`)
+	pre := async.SentCount()
+
+	// public gap resubscribes the public channels
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454],6]`)
+	gap, err := listener.nextSequenceGap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.SequenceGap{Private: false, Expected: 5, Received: 6, Policy: websocket.SequenceGapResync}, gap)
+	if err := async.waitForMessage(pre + 1); err != nil {
+		t.Fatal(err)
+	}
+	resub := async.Sent[pre+1].(*websocket.SubscriptionRequest)
+	assert(t, "ticker", resub.Channel)
+	assert(t, "tBTCUSD", resub.Symbol)
+
+	// private gap re-authenticates for fresh snapshots
+	async.Publish(`[0,"wu",["exchange","BTC",32,0,32],7,5]`)
+	gap, err = listener.nextSequenceGap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, true, gap.Private)
+	assert(t, int64(4), gap.Expected)
+	assert(t, int64(5), gap.Received)
+	if err := async.waitForMessage(pre + 2); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := json.Marshal(async.Sent[pre+2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `{"event":"unauth"}`, string(msg))
+}
+
+func TestSequenceOfUnsubscribedChannel(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.EnableFlag(context.Background(), bitfinex.Seq_all); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + id + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,"hb",1]`)
+
+	// a late message of an unsubscribed channel still advances the sequence
+	async.Publish(`[9,"hb",2]`)
+	async.Publish(`[5,"hb",3]`)
+	if gap, err := listener.nextSequenceGap(); err == nil {
+		t.Fatalf("unexpected sequence gap %#v", gap)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listener.nextLifecycleEvent(); err != nil { // SocketConnected
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.SubscribeTicker(context.Background(), "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce2","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// entering maintenance pauses requests
+	async.Publish(`{"event":"info","code":20060,"msg":"Entering in Maintenance mode"}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := listener.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ev.(*websocket.MaintenanceStarted); !ok {
+		t.Fatalf("expected MaintenanceStarted, got %#v", ev)
+	}
+	assert(t, true, ws.InMaintenance())
+	pre := async.SentCount()
+	err = ws.SubmitOrder(context.Background(), &bitfinex.OrderNewRequest{
+		CID:    123,
+		Type:   "EXCHANGE LIMIT",
+		Symbol: "tBTCUSD",
+		Amount: 0.01,
+		Price:  9000,
+	})
+	if err != websocket.ErrMaintenance {
+		t.Fatalf("expected ErrMaintenance, got %v", err)
+	}
+	if _, err := ws.SubscribeTrades(context.Background(), "tBTCUSD"); err != websocket.ErrMaintenance {
+		t.Fatalf("expected ErrMaintenance, got %v", err)
+	}
+	assert(t, pre, async.SentCount())
+
+	// maintenance end resubscribes the public channels
+	async.Publish(`{"event":"info","code":20061,"msg":"Maintenance ended"}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	ev, err = listener.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended, ok := ev.(*websocket.MaintenanceEnded)
+	if !ok {
+		t.Fatalf("expected MaintenanceEnded, got %#v", ev)
+	}
+	assert(t, &websocket.MaintenanceEnded{Subscriptions: 1}, ended)
+	assert(t, false, ws.InMaintenance())
+	unsub, err := json.Marshal(async.Sent[pre])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `{"event":"unsubscribe","chanId":5}`, string(unsub))
+	sub := async.Sent[pre+1].(*websocket.SubscriptionRequest)
+	assert(t, "ticker", sub.Channel)
+	assert(t, "tBTCUSD", sub.Symbol)
+
+	if err := ws.SubmitOrder(context.Background(), &bitfinex.OrderNewRequest{CID: 123, Symbol: "tBTCUSD", Amount: 0.01, Price: 9000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// returns the next MaintenanceEnded, skipping other lifecycle events
+func nextMaintenanceEnded(l *listener) (*websocket.MaintenanceEnded, error) {
+	for {
+		ev, err := l.nextLifecycleEvent()
+		if err != nil {
+			return nil, err
+		}
+		if ended, ok := ev.(*websocket.MaintenanceEnded); ok {
+			return ended, nil
+		}
+	}
+}
+
+func TestMaintenanceEndPerSocket(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+	factory := newTestAsyncFactory(async).(*TestAsyncFactory)
+
+	// create client, every channel on its own socket
+	p := websocket.NewDefaultParameters()
+	p.CapacityPerConnection = 1
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, factory, nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2,"platform":{"status":1}}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	ticker, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + ticker + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	trades, err := ws.SubscribeTrades(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, ws.ConnectionCount())
+	second := factory.Created(0)
+	second.Publish(`{"event":"info","version":2,"platform":{"status":1}}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	second.Publish(`{"event":"subscribed","channel":"trades","chanId":6,"symbol":"tBTCUSD","subId":"` + trades + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the platform notifies every socket, each resubscribes its own channels
+	async.Publish(`{"event":"info","code":20060,"msg":"Entering in Maintenance mode"}`)
+	second.Publish(`{"event":"info","code":20060,"msg":"Entering in Maintenance mode"}`)
+	pre, preSecond := async.SentCount(), second.SentCount()
+	async.Publish(`{"event":"info","code":20061,"msg":"Maintenance ended"}`)
+	ended, err := nextMaintenanceEnded(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.MaintenanceEnded{SocketId: 0, Subscriptions: 1}, ended)
+	if err := async.waitForMessage(pre + 1); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "ticker", async.Sent[pre+1].(*websocket.SubscriptionRequest).Channel)
+	assert(t, preSecond, second.SentCount())
+
+	second.Publish(`{"event":"info","code":20061,"msg":"Maintenance ended"}`)
+	ended, err = nextMaintenanceEnded(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, websocket.SocketId(1), ended.SocketId)
+	assert(t, 1, ended.Subscriptions)
+	if err := second.waitForMessage(preSecond + 1); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "trades", second.Sent[preSecond+1].(*websocket.SubscriptionRequest).Channel)
+}
+
+func TestMaintenanceEndedByOperativePlatform(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	ws := websocket.NewWithAsyncFactory(newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2,"platform":{"status":1}}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"info","code":20060,"msg":"Entering in Maintenance mode"}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, true, ws.InMaintenance())
+
+	// a fresh info event of an operative platform ends a missed maintenance end
+	async.Publish(`{"event":"info","version":2,"platform":{"status":1}}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nextMaintenanceEnded(listener); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, false, ws.InMaintenance())
+}
+
+func TestPublicOffAuthSelector(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.SocketSelector = &websocket.PublicOffAuthSelector{}
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// begin test
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// public data is kept off the authenticating socket
+	if _, err := ws.SubscribeTicker(context.Background(), "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, ws.ConnectionCount())
+	assert(t, 1, async.SentCount())
+	if _, err := ws.SubscribeTrades(context.Background(), "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, ws.ConnectionCount())
+	assert(t, 1, async.SentCount())
+
+	// a pinned subscription lands on the chosen socket
+	id, err := ws.SubscribeOnSocket(context.Background(), 0, &websocket.SubscriptionRequest{
+		Event:   websocket.EventSubscribe,
+		Channel: websocket.ChanTicker,
+		Symbol:  "tETHUSD",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	pinned := async.Sent[1].(*websocket.SubscriptionRequest)
+	assert(t, id, pinned.SubID)
+	assert(t, "tETHUSD", pinned.Symbol)
+}
+
+func TestSymbolHashSelector(t *testing.T) {
+	selector := &websocket.SymbolHashSelector{Connections: 3}
+	req := &websocket.SubscriptionRequest{Event: websocket.EventSubscribe, Channel: websocket.ChanBook, Symbol: "tBTCUSD"}
+	states := []websocket.SocketState{{Id: 0, Capacity: 25}}
+
+	// opens connections until all exist
+	if _, ok := selector.Subscription(req, states); ok {
+		t.Fatal("expected a new connection")
+	}
+	states = append(states, websocket.SocketState{Id: 1, Capacity: 25}, websocket.SocketState{Id: 2, Capacity: 25})
+	id, ok := selector.Subscription(req, states)
+	if !ok {
+		t.Fatal("expected a socket")
+	}
+	// the symbol always lands on the same socket, all of its channels included
+	for i := 0; i < 5; i++ {
+		other, _ := selector.Subscription(&websocket.SubscriptionRequest{Event: websocket.EventSubscribe, Channel: websocket.ChanTrades, Symbol: "tBTCUSD"}, states)
+		if other != id {
+			t.Fatalf("expected socket %d, got %d", id, other)
+		}
+	}
+	// a full socket falls back to the most available one
+	states[id].Capacity = 0
+	states[(int(id)+1)%3].Capacity = 10
+	other, ok := selector.Subscription(req, states)
+	if !ok {
+		t.Fatal("expected a socket")
+	}
+	if other == id {
+		t.Fatalf("expected a socket other than the full socket %d", id)
+	}
+}
+
+// declines every socket
+type decliningSelector struct {
+	websocket.MostAvailableSelector
+}
+
+func (s *decliningSelector) Subscription(req *websocket.SubscriptionRequest, sockets []websocket.SocketState) (websocket.SocketId, bool) {
+	return 0, false
+}
+
+func TestDecliningSelector(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.SocketSelector = &decliningSelector{}
+	p.ConnectionLimiter = nil
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// planning fails before any connection is opened
+	reqs := []*websocket.SubscriptionRequest{{Event: websocket.EventSubscribe, Channel: websocket.ChanTicker, Symbol: "tBTCUSD"}}
+	if _, err := ws.SubscribeMany(context.Background(), reqs...); err == nil {
+		t.Fatal("expected an error for a declining selector")
+	}
+	assert(t, 1, ws.ConnectionCount())
+
+	// subscribing gives up after a bounded number of connections
+	if _, err := ws.SubscribeTicker(context.Background(), "tBTCUSD"); err == nil {
+		t.Fatal("expected an error for a declining selector")
+	}
+	assert(t, 21, ws.ConnectionCount())
+}
+
+func TestSubscribeManyWithoutCapacity(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.CapacityPerConnection = 0
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	reqs := []*websocket.SubscriptionRequest{
+		{Event: websocket.EventSubscribe, Channel: websocket.ChanTicker, Symbol: "tBTCUSD"},
+		{Event: websocket.EventSubscribe, Channel: websocket.ChanTicker, Symbol: "tETHUSD"},
+	}
+	if _, err := ws.SubscribeMany(context.Background(), reqs...); err == nil {
+		t.Fatal("expected an error without capacity per connection")
+	}
+	assert(t, 1, ws.ConnectionCount())
+	assert(t, 0, async.SentCount())
+}
+
+func TestAccountState(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	params := websocket.NewDefaultParameters()
+	params.ManageAccountState = true
+	ws := websocket.NewWithParamsAsyncFactoryNonce(params, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+	state, err := ws.AccountState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan *websocket.AccountChange, 20)
+	state.OnChange(func(change *websocket.AccountChange) {
+		changes <- change
+	})
+	nextChange := func() *websocket.AccountChange {
+		select {
+		case change := <-changes:
+			return change
+		case <-time.After(time.Second * 2):
+			t.Fatal("timed out waiting for account change")
+		}
+		return nil
+	}
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshots after authentication
+	async.Publish(`[0,"os",[[1234567,0,123,"tBTCUSD",1514909325236,1514909325631,1,1,"LIMIT",null,null,null,0,"ACTIVE",null,null,900,0,null,null,null,null,null,0,0,0]]]`)
+	async.Publish(`[0,"ps",[["tBTCUSD","ACTIVE",7,916.52002351,0,0,null,null,null,null]]]`)
+	async.Publish(`[0,"ws",[["exchange","BTC",30,0,null],["exchange","USD",80000,0,null]]]`)
+	async.Publish(`[0,"fos",[]]`)
+	for _, entity := range []websocket.AccountEntity{websocket.AccountOrders, websocket.AccountPositions, websocket.AccountWallets, websocket.AccountFundingOffers} {
+		change := nextChange()
+		if change.Entity != entity || change.Action != websocket.AccountSnapshot {
+			t.Fatalf("expected %s snapshot, got %s %s", entity, change.Entity, change.Action)
+		}
+	}
+	if len(state.Orders()) != 1 || len(state.Positions()) != 1 || len(state.Wallets()) != 2 || len(state.FundingOffers()) != 0 {
+		t.Fatalf("unexpected snapshot state: %d orders, %d positions, %d wallets, %d offers",
+			len(state.Orders()), len(state.Positions()), len(state.Wallets()), len(state.FundingOffers()))
+	}
+
+	// updates
+	async.Publish(`[0,"on",[1234568,0,124,"tBTCUSD",1514909325236,1514909325631,2,2,"LIMIT",null,null,null,0,"ACTIVE",null,null,910,0,null,null,null,null,null,0,0,0]]`)
+	async.Publish(`[0,"oc",[1234567,0,123,"tBTCUSD",1514909325236,1514909325631,0,1,"LIMIT",null,null,null,0,"EXECUTED @ 900.0(1.0)",null,null,900,900,null,null,null,null,null,0,0,0]]`)
+	async.Publish(`[0,"wu",["exchange","BTC",25,0,25]]`)
+	async.Publish(`[0,"pc",["tBTCUSD","CLOSED",0,916.52002351,0,0,null,null,null,null]]`)
+	expected := []websocket.AccountChange{
+		{Entity: websocket.AccountOrders, Action: websocket.AccountUpdated},
+		{Entity: websocket.AccountOrders, Action: websocket.AccountRemoved},
+		{Entity: websocket.AccountWallets, Action: websocket.AccountUpdated},
+		{Entity: websocket.AccountPositions, Action: websocket.AccountRemoved},
+	}
+	for _, exp := range expected {
+		change := nextChange()
+		if change.Entity != exp.Entity || change.Action != exp.Action {
+			t.Fatalf("expected %s %s, got %s %s", exp.Entity, exp.Action, change.Entity, change.Action)
+		}
+	}
+	orders := state.Orders()
+	if len(orders) != 1 {
+		t.Fatalf("expected 1 open order, got %d", len(orders))
+	}
+	if o := orders[0]; o.ID != 1234568 || o.CID != 124 || o.Symbol != "tBTCUSD" || o.Amount != 2 || o.Price != 910 {
+		t.Fatalf("unexpected open order: %#v", o)
+	}
+	wallet, ok := state.Wallet("exchange", "BTC")
+	if !ok {
+		t.Fatal("expected exchange BTC wallet")
+	}
+	assert(t, &bitfinex.Wallet{Type: "exchange", Currency: "BTC", Balance: 25, BalanceAvailable: 25}, wallet)
+	if _, ok := state.Position("tBTCUSD"); ok {
+		t.Fatal("expected closed position to be removed")
+	}
+
+	// the snapshots of a re-authentication rebuild the state
+	async.Publish(`[0,"os",[]]`)
+	if change := nextChange(); change.Entity != websocket.AccountOrders || change.Action != websocket.AccountSnapshot {
+		t.Fatalf("expected orders snapshot, got %s %s", change.Entity, change.Action)
+	}
+	if len(state.Orders()) != 0 {
+		t.Fatalf("expected empty orders after snapshot, got %d", len(state.Orders()))
+	}
 }
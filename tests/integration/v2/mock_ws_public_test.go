@@ -2,7 +2,12 @@ package tests
 
 import (
 	"context"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bitfinexcom/bitfinex-api-go/v2"
 	"github.com/bitfinexcom/bitfinex-api-go/v2/websocket"
@@ -166,6 +171,397 @@ func TestOrderbook(t *testing.T) {
 	}
 }
 
+func TestRawOrderbook(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// info welcome msg
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	bId, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.PrecisionRawBook, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"conf","status":"OK","flags":131072}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"R0","freq":"F0","len":"25","subId":"` + bId + `","pair":"BTCUSD"}`)
+	// [ID, price, amount]
+	async.Publish(`[5,[[101,7000,1.5],[102,7000,0.5],[103,6999,2],[201,7001,-1],[202,7002,-3]]]`)
+	// move an order, remove an order and add an order at an existing level
+	async.Publish(`[5,[102,6998,0.5]]`)
+	async.Publish(`[5,[201,0,-1]]`)
+	async.Publish(`[5,[203,7002,-0.25]]`)
+
+	// checksum is calculated from order IDs and amounts
+	pre := async.SentCount()
+	async.Publish(`[5,"cs",` + strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("101:1.5:202:-3:103:2:203:-0.25:102:0.5")))), 10) + `]`)
+
+	ob, err := ws.GetRawOrderbook("tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.GetOrderbook("tBTCUSD"); err == nil {
+		t.Fatal("raw book updates should not be managed in a price level orderbook")
+	}
+	bids := ob.BidLevels(-1)
+	if len(bids) != 3 {
+		t.Fatalf("expected 3 bid levels, got %d", len(bids))
+	}
+	assert(t, 7000.0, bids[0].Price)
+	assert(t, int64(1), bids[0].Count)
+	assert(t, 6998.0, bids[2].Price)
+	asks := ob.AskLevels(1)
+	if len(asks) != 1 {
+		t.Fatalf("expected 1 ask level, got %d", len(asks))
+	}
+	assert(t, 7002.0, asks[0].Price)
+	assert(t, int64(2), asks[0].Count)
+	assert(t, 3.25, asks[0].Amount)
+	if _, ok := ob.Order(201); ok {
+		t.Fatal("expected order 201 to be removed")
+	}
+
+	// a valid checksum does not trigger a resubscribe
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected message sent after checksum")
+	}
+}
+
+func TestFundingOrderbook(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// info welcome msg
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// receive updates on a subscription stream
+	stream, err := ws.SubscribeStream(context.Background(), &websocket.SubscriptionRequest{
+		Event:     websocket.EventSubscribe,
+		Channel:   websocket.ChanBook,
+		Symbol:    "fUSD",
+		Precision: string(bitfinex.Precision0),
+		Frequency: string(bitfinex.FrequencyRealtime),
+		Len:       "25",
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() interface{} {
+		select {
+		case msg := <-stream.Listen():
+			return msg
+		case <-time.After(time.Second * 2):
+			t.Fatal("timed out waiting for fUSD stream data")
+		}
+		return nil
+	}
+	async.Publish(`{"event":"conf","status":"OK","flags":131072}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":7,"symbol":"fUSD","prec":"P0","freq":"F0","len":"25","subId":"` + stream.SubID() + `","currency":"USD"}`)
+	// [rate, period, count, amount], bids carry negative amounts
+	async.Publish(`[7,[[0.0002,2,3,-1000],[0.00019,30,1,-500],[0.00021,2,5,2000],[0.00022,7,1,300]]]`)
+	snap, ok := next().(*bitfinex.FundingBookUpdateSnapshot)
+	if !ok {
+		t.Fatal("expected funding book snapshot")
+	}
+	assert(t, &bitfinex.FundingBookUpdate{
+		Symbol: "fUSD",
+		Rate:   0.00019,
+		Period: 30,
+		Count:  1,
+		Amount: 500,
+		Side:   bitfinex.Bid,
+	}, snap.Snapshot[1])
+
+	async.Publish(`[7,[0.00019,30,0,-1]]`)
+	async.Publish(`[7,[0.000205,2,1,-50]]`)
+	update, ok := next().(*bitfinex.FundingBookUpdate)
+	if !ok {
+		t.Fatal("expected funding book update")
+	}
+	assert(t, bitfinex.BookRemoveEntry, update.Action)
+	next()
+
+	pre := async.SentCount()
+	async.Publish(`[7,"cs",` + strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("0.000205:-50:0.00021:2000:0.0002:-1000:0.00022:300")))), 10) + `]`)
+
+	ob, err := ws.GetFundingOrderbook("fUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bids := ob.Bids()
+	if len(bids) != 2 {
+		t.Fatalf("expected 2 bids, got %d", len(bids))
+	}
+	assert(t, 0.000205, bids[0].Rate)
+	assert(t, 0.0002, bids[1].Rate)
+	asks := ob.TopAsks(1)
+	if len(asks) != 1 {
+		t.Fatalf("expected 1 ask, got %d", len(asks))
+	}
+	assert(t, 0.00021, asks[0].Rate)
+	assert(t, int64(2), asks[0].Period)
+
+	// a valid checksum does not trigger a resubscribe
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected message sent after checksum")
+	}
+}
+
+func TestOrderbookPerPrecision(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// info welcome msg
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	p0, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision0, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision2, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"conf","status":"OK","flags":131072}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + p0 + `","pair":"BTCUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":6,"symbol":"tBTCUSD","prec":"P2","freq":"F0","len":"25","subId":"` + p2 + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,[[7000.5,1,1],[7001.5,1,-1]]]`)
+	async.Publish(`[6,[[7000,4,10],[7100,2,-5]]]`)
+	async.Publish(`[6,[7000,5,12]]`)
+
+	// the P2 checksum is verified against the P2 book
+	ob2, err := ws.GetOrderbookBySubscription(p2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, remove := ob2.ObserveChan(10)
+	defer remove()
+	pre := async.SentCount()
+	async.Publish(`[6,"cs",` + strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("7000:12:7100:-5")))), 10) + `]`)
+	for checksum := (*websocket.ChecksumResult)(nil); checksum == nil; {
+		// skip the pending update of the book
+		select {
+		case ev := <-events:
+			checksum = ev.(*websocket.OrderbookEvent).Checksum
+		case <-time.After(time.Second * 2):
+			t.Fatal("timed out waiting for checksum event")
+		}
+		if checksum != nil {
+			assert(t, true, checksum.Valid)
+		}
+	}
+
+	if _, err := ws.GetOrderbook("tBTCUSD"); err == nil {
+		t.Fatal("expected an error for a symbol with multiple managed books")
+	}
+	ob0, err := ws.GetOrderbookBySubscription(p0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 7000.5, ob0.Bids()[0].Price)
+	assert(t, 7000.0, ob2.Bids()[0].Price)
+	assert(t, 12.0, ob2.Bids()[0].Amount)
+
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected message sent after checksum")
+	}
+}
+
+func TestOrderbookObserverCallsClient(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// info welcome msg
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision0, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + id + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,[[7000.5,1,1],[7001.5,1,-1]]]`)
+	async.Publish(`[5,[7000.5,1,2]]`)
+	ob, err := ws.GetOrderbookBySubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// observers are notified once the client released its locks
+	type observed struct {
+		snapshot bool
+		err      error
+	}
+	events := make(chan observed, 10)
+	remove := ob.Observe(func(ev *websocket.OrderbookEvent) {
+		_, err := ws.GetOrderbook("tBTCUSD")
+		events <- observed{snapshot: ev.Snapshot, err: err}
+	})
+	defer remove()
+	next := func() observed {
+		select {
+		case ev := <-events:
+			if ev.err != nil {
+				t.Fatal(ev.err)
+			}
+			return ev
+		case <-time.After(time.Second * 2):
+			t.Fatal("observer blocked reading the book through the client")
+		}
+		return observed{}
+	}
+
+	async.Publish(`[5,[7000,1,2]]`)
+	assert(t, false, next().snapshot)
+	async.Publish(`[5,[[7000.5,1,3],[7001.5,1,-1]]]`)
+	assert(t, true, next().snapshot)
+}
+
+func TestOrderbookReleasedOnUnsubscribe(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// info welcome msg
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	p0, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision0, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision2, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + p0 + `","pair":"BTCUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":6,"symbol":"tBTCUSD","prec":"P2","freq":"F0","len":"25","subId":"` + p2 + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,[[7000.5,1,1],[7001.5,1,-1]]]`)
+	async.Publish(`[6,[[7000,4,10],[7100,2,-5]]]`)
+	async.Publish(`[6,[7000,5,12]]`)
+	ob2, err := ws.GetOrderbookBySubscription(p2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the P0 book is dropped with its subscription, the P2 book is kept
+	if err := ws.Unsubscribe(context.Background(), p0); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"unsubscribed","status":"OK","chanId":5}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	ob, err := ws.GetOrderbook("tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ob != ob2 {
+		t.Fatal("expected the P2 book to be the only managed book")
+	}
+
+	if err := ws.Unsubscribe(context.Background(), p2); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"unsubscribed","status":"OK","chanId":6}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.GetOrderbook("tBTCUSD"); err == nil {
+		t.Fatal("expected no managed book after unsubscribing")
+	}
+}
+
 func TestCreateNewSocket(t *testing.T) {
 	// create transport & nonce mocks
 	async := newTestAsync()
@@ -226,3 +622,892 @@ func TestCreateNewSocket(t *testing.T) {
 		t.Fatal("Expected socket count to be 6 but got", conCount)
 	}
 }
+
+func TestSubscriptionStream(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// info welcome msg
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// subscribe with a dedicated stream per symbol
+	btc, err := ws.SubscribeStream(context.Background(), &websocket.SubscriptionRequest{
+		Event:   websocket.EventSubscribe,
+		Channel: websocket.ChanTicker,
+		Symbol:  "tBTCUSD",
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth, err := ws.SubscribeStream(context.Background(), &websocket.SubscriptionRequest{
+		Event:   websocket.EventSubscribe,
+		Channel: websocket.ChanTicker,
+		Symbol:  "tETHUSD",
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "nonce1", btc.SubID())
+	assert(t, "nonce2", eth.SubID())
+
+	// subscribe acks are still published on the client listener
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":6,"symbol":"tETHUSD","subId":"nonce2","pair":"ETHUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// tick data is routed to the matching stream only
+	async.Publish(`[6,[190.1,10,190.2,12,-1,-0.01,190.15,1000,195,185]]`)
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+	select {
+	case msg := <-btc.Listen():
+		assert(t, "tBTCUSD", msg.(*bitfinex.Ticker).Symbol)
+		assert(t, 14971.0, msg.(*bitfinex.Ticker).LastPrice)
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out waiting for tBTCUSD stream data")
+	}
+	select {
+	case msg := <-eth.Listen():
+		assert(t, "tETHUSD", msg.(*bitfinex.Ticker).Symbol)
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out waiting for tETHUSD stream data")
+	}
+
+	// unsubscribe closes the stream once acknowledged
+	if err := btc.Unsubscribe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"unsubscribed","chanId":5,"status":"OK"}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-btc.Listen():
+		if ok {
+			t.Fatal("expected tBTCUSD stream to be closed")
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out waiting for tBTCUSD stream to close")
+	}
+}
+
+func TestSubscribeFuncCloseInCallback(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the client closes the stream from within its callback
+	closed := make(chan struct{})
+	_, err := ws.SubscribeFunc(context.Background(), &websocket.SubscriptionRequest{
+		Event:   websocket.EventSubscribe,
+		Channel: websocket.ChanTicker,
+		Symbol:  "tBTCUSD",
+	}, func(msg interface{}) {
+		ws.Close()
+		close(closed)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("deadlock closing the client from a stream callback")
+	}
+}
+
+func TestListenerCloseWhileBlocked(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client, nobody consumes the blocking Listen() channel
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	// the connected event does not hold up the read routine
+	read := make(chan struct{})
+	go func() {
+		async.Publish(`{"event":"info","version":2}`)
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-time.After(time.Second * 2):
+		t.Fatal("socket read routine blocked by the connected event")
+	}
+	// let the read routine block publishing the info event
+	time.Sleep(time.Millisecond * 100)
+
+	// closing releases the blocked read routine instead of sending on the
+	// closed listener channel
+	ws.Close()
+	time.Sleep(time.Millisecond * 100)
+	for range ws.Listen() {
+	}
+}
+
+func TestListenerBackpressure(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client with a small listener buffer that drops new messages
+	p := websocket.NewDefaultParameters()
+	p.ListenerBufferSize = 3
+	p.ListenerPolicy = websocket.BackpressureDropNewest
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// do not consume the listener so the buffer fills up
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := ws.SubscribeTicker(context.Background(), "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	for i := 0; i < 3; i++ {
+		async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+	}
+	waitForDropped := func(count uint64) {
+		for i := 0; i < 20; i++ {
+			if ws.DroppedMessages() == count {
+				return
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+		t.Fatalf("expected %d dropped messages, got %d", count, ws.DroppedMessages())
+	}
+	waitForDropped(3)
+
+	// the socket read routine is not blocked and buffered messages are intact
+	if _, ok := (<-ws.Listen()).(*websocket.SocketConnected); !ok {
+		t.Fatal("expected buffered socket connected event")
+	}
+	if _, ok := (<-ws.Listen()).(*websocket.InfoEvent); !ok {
+		t.Fatal("expected buffered info event")
+	}
+	if _, ok := (<-ws.Listen()).(*websocket.SubscribeEvent); !ok {
+		t.Fatal("expected buffered subscribe event")
+	}
+
+	// the next message is preceded by a gap event
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+	gap, ok := (<-ws.Listen()).(*websocket.MessageGap)
+	if !ok {
+		t.Fatal("expected gap event")
+	}
+	assert(t, uint64(3), gap.Dropped)
+	assert(t, uint64(3), gap.TotalDropped)
+	if _, ok := (<-ws.Listen()).(*bitfinex.Ticker); !ok {
+		t.Fatal("expected ticker after gap event")
+	}
+}
+
+type testBookSnapshotProvider struct {
+	lock     sync.Mutex
+	requests []string
+	snapshot *bitfinex.BookUpdateSnapshot
+	release  chan struct{} // holds back the snapshot until closed, if set
+}
+
+func (p *testBookSnapshotProvider) All(symbol string, precision bitfinex.BookPrecision, priceLevels int) (*bitfinex.BookUpdateSnapshot, error) {
+	p.lock.Lock()
+	p.requests = append(p.requests, symbol+":"+string(precision)+":"+strconv.Itoa(priceLevels))
+	p.lock.Unlock()
+	if p.release != nil {
+		<-p.release
+	}
+	return p.snapshot, nil
+}
+
+func (p *testBookSnapshotProvider) requested() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+// waits until the managed book satisfies the condition
+func waitForBook(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 2)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the managed book")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// subscribes a managed P1 book of tBTCUSD and reports a checksum mismatch
+func checksumMismatch(t *testing.T, p *websocket.Parameters) (*TestAsync, *websocket.Client, *listener, string) {
+	async := newTestAsync()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+	listener := newListener()
+	listener.run(ws.Listen())
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision1, bitfinex.FrequencyTwoPerSecond, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"conf","status":"OK","flags":131072}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P1","freq":"F1","len":"100","subId":"` + id + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,[[7000,1,1],[7001,1,-1]]]`)
+	async.Publish(`[5,"cs",1]`)
+	return async, ws, listener, id
+}
+
+func TestChecksumMismatchResubscribe(t *testing.T) {
+	async, ws, listener, id := checksumMismatch(t, websocket.NewDefaultParameters())
+	defer ws.Close()
+
+	ev, err := listener.nextChecksumMismatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.ChecksumMismatch{SubID: id, Symbol: "tBTCUSD", Precision: "P1", Expected: 1, Calculated: crc32.ChecksumIEEE([]byte("7000:1:7001:-1")), Mismatches: 1}, ev)
+	assert(t, websocket.ChecksumResubscribe, ev.Policy)
+
+	// unsubscribe & subscribe with identical book parameters
+	if err := async.waitForMessage(3); err != nil {
+		t.Fatal(err)
+	}
+	resub := async.Sent[3].(*websocket.SubscriptionRequest)
+	assert(t, "book", resub.Channel)
+	assert(t, "tBTCUSD", resub.Symbol)
+	assert(t, "P1", resub.Precision)
+	assert(t, "F1", resub.Frequency)
+	assert(t, "100", resub.Len)
+	if resub.SubID == id {
+		t.Fatal("expected a new subscription ID")
+	}
+
+	// the new snapshot replaces the same managed book
+	async.Publish(`{"event":"unsubscribed","status":"OK","chanId":5}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":7,"symbol":"tBTCUSD","prec":"P1","freq":"F1","len":"100","subId":"` + resub.SubID + `","pair":"BTCUSD"}`)
+	async.Publish(`[7,[[7002,2,3]]]`)
+	ob, err := ws.GetOrderbookBySubscription(resub.SubID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[7,"cs",` + strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("7002:3")))), 10) + `]`)
+	assert(t, 7002.0, ob.Bids()[0].Price)
+	assert(t, uint64(1), ob.ChecksumMismatches())
+}
+
+func TestChecksumMismatchReseed(t *testing.T) {
+	snapshot, err := bitfinex.NewBookUpdateSnapshotFromRaw("tBTCUSD", "P1", [][]float64{{7000, 2, 4}, {7001, 1, -1}}, []interface{}{[]interface{}{7000.0, 2.0, 4.0}, []interface{}{7001.0, 1.0, -1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &testBookSnapshotProvider{snapshot: snapshot}
+	p := websocket.NewDefaultParameters()
+	p.ChecksumPolicy = websocket.ChecksumReseed
+	p.BookSnapshotProvider = provider
+	async, ws, listener, id := checksumMismatch(t, p)
+	defer ws.Close()
+
+	ev, err := listener.nextChecksumMismatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, websocket.ChecksumReseed, ev.Policy)
+	pre := async.SentCount()
+
+	// the book keeps streaming on top of the reseeded snapshot
+	async.Publish(`[5,[7001,2,-3]]`)
+	ob, err := ws.GetOrderbookBySubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForBook(t, func() bool { return ob.Bids()[0].Amount == 4.0 && ob.Asks()[0].Amount == 3.0 })
+	async.Publish(`[5,"cs",` + strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("7000:4:7001:-3")))), 10) + `]`)
+	requests := provider.requested()
+	assert(t, 1, len(requests))
+	assert(t, "tBTCUSD:P1:100", requests[0])
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected message sent after reseed")
+	}
+	assert(t, uint64(1), ob.ChecksumMismatches())
+}
+
+func TestChecksumMismatchReseedHoldsBackUpdates(t *testing.T) {
+	snapshot, err := bitfinex.NewBookUpdateSnapshotFromRaw("tBTCUSD", "P1", [][]float64{{7000, 2, 4}, {7001, 1, -1}}, []interface{}{[]interface{}{7000.0, 2.0, 4.0}, []interface{}{7001.0, 1.0, -1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &testBookSnapshotProvider{snapshot: snapshot, release: make(chan struct{})}
+	p := websocket.NewDefaultParameters()
+	p.ChecksumPolicy = websocket.ChecksumReseed
+	p.BookSnapshotProvider = provider
+	async, ws, listener, id := checksumMismatch(t, p)
+	defer ws.Close()
+
+	if _, err := listener.nextChecksumMismatch(); err != nil {
+		t.Fatal(err)
+	}
+	pre := async.SentCount()
+
+	// the read routine is not blocked by the pending snapshot
+	read := make(chan struct{})
+	go func() {
+		async.Publish(`[5,[7001,2,-3]]`)
+		// checksums of the held back book are not verified
+		async.Publish(`[5,"cs",2]`)
+		async.Publish(`[5,"hb"]`)
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-time.After(time.Second * 2):
+		t.Fatal("read routine blocked by the reseed")
+	}
+	ob, err := ws.GetOrderbookBySubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 1.0, ob.Bids()[0].Amount)
+	assert(t, 1.0, ob.Asks()[0].Amount)
+
+	// the held back update is replayed on top of the snapshot
+	close(provider.release)
+	waitForBook(t, func() bool { return ob.Bids()[0].Amount == 4.0 && ob.Asks()[0].Amount == 3.0 })
+	assert(t, uint64(1), ob.ChecksumMismatches())
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected message sent after reseed")
+	}
+}
+
+func TestChecksumMismatchNotify(t *testing.T) {
+	p := websocket.NewDefaultParameters()
+	p.ChecksumPolicy = websocket.ChecksumNotify
+	async, ws, listener, id := checksumMismatch(t, p)
+	defer ws.Close()
+
+	ev, err := listener.nextChecksumMismatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, websocket.ChecksumNotify, ev.Policy)
+	pre := async.SentCount()
+	async.Publish(`[5,"cs",2]`)
+	ev, err = listener.nextChecksumMismatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, uint64(2), ev.Mismatches)
+	ob, err := ws.GetOrderbookBySubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, uint64(2), ob.ChecksumMismatches())
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected message sent after checksum mismatch")
+	}
+}
+
+func TestFlagsPersistAcrossReconnects(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	ws := websocket.NewWithAsyncFactory(newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every conf request carries all enabled flags
+	if _, err := ws.EnableFlag(context.Background(), bitfinex.Timestamp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.EnableFlag(context.Background(), bitfinex.Seq_all); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: bitfinex.Timestamp}, async.Sent[0])
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: bitfinex.Timestamp + bitfinex.Seq_all}, async.Sent[1])
+
+	// a re-opened socket gets the enabled flags
+	async.Publish(`{"event":"info","version":2}`)
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: bitfinex.Timestamp + bitfinex.Seq_all}, async.Sent[2])
+
+	if _, err := ws.DisableFlag(context.Background(), bitfinex.Timestamp); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: bitfinex.Seq_all}, async.Sent[3])
+	assert(t, bitfinex.Seq_all, ws.Flags())
+}
+
+func TestBulkUpdatesWithDecimalStrings(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.EnableFlag(context.Background(), bitfinex.Bulk_updates|bitfinex.Dec_s); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: bitfinex.Checksum + bitfinex.Bulk_updates + bitfinex.Dec_s}, async.Sent[1])
+
+	id, err := ws.SubscribeBook(context.Background(), "tBTCUSD", bitfinex.Precision0, bitfinex.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + id + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,[["7000",1,"1.50"],["7001",1,"-1"]],1591779600000]`)
+	// bulk updates are applied to the book instead of replacing it
+	async.Publish(`[5,[["6999",2,"0.25"],["7001",0,"-1"]],1591779600001]`)
+	pre := async.SentCount()
+	async.Publish(`[5,"cs",` + strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("7000:1.50:6999:0.25")))), 10) + `,1591779600002]`)
+
+	ob, err := ws.GetOrderbookBySubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, len(ob.Bids()))
+	assert(t, 0, len(ob.Asks()))
+	assert(t, 1.5, ob.Bids()[0].Amount)
+	assert(t, 6999.0, ob.Bids()[1].Price)
+	if err := async.waitForMessage(pre); err == nil {
+		t.Fatal("unexpected resubscription after a valid checksum")
+	}
+}
+
+func TestUpdateTimestamps(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	ws := websocket.NewWithAsyncFactory(newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + id + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the flag updates carry no timestamp
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+	tick, err := listener.nextTick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, int64(0), tick.ServerMTS)
+	assert(t, time.Duration(0), tick.Latency())
+
+	if _, err := ws.EnableFlag(context.Background(), bitfinex.Timestamp); err != nil {
+		t.Fatal(err)
+	}
+	sent := time.Now().Add(-time.Second)
+	mts := sent.UnixNano() / int64(time.Millisecond)
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454],` + strconv.FormatInt(mts, 10) + `]`)
+	tick, err = listener.nextTick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, mts, tick.ServerMTS)
+	assert(t, 14957.0, tick.Bid)
+	if tick.ReceivedAt.Before(sent) {
+		t.Fatalf("expected receive time after %s, got %s", sent, tick.ReceivedAt)
+	}
+	if latency := tick.Latency(); latency < time.Second || latency > 5*time.Second {
+		t.Fatalf("expected a latency of about one second, got %s", latency)
+	}
+
+	// a server clock ahead of the local clock skews the latency, the offset of
+	// the server clock corrects it
+	clock := bitfinex.NewServerClock()
+	now := time.Now()
+	clock.Observe(now.Add(time.Minute), 0, now, now)
+	sent = time.Now().Add(-time.Second)
+	mts = sent.Add(time.Minute).UnixNano() / int64(time.Millisecond)
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454],` + strconv.FormatInt(mts, 10) + `]`)
+	tick, err = listener.nextTick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latency := tick.Latency(); latency >= 0 {
+		t.Fatalf("expected a skewed latency, got %s", latency)
+	}
+	if latency := tick.LatencyWith(clock); latency < time.Second || latency > 5*time.Second {
+		t.Fatalf("expected a corrected latency of about one second, got %s", latency)
+	}
+}
+
+func TestSubscribeAndWait(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		ev  *websocket.SubscribeEvent
+		err error
+	}
+	subscribe := func(req *websocket.SubscriptionRequest) chan result {
+		ch := make(chan result, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
+			ev, err := ws.SubscribeAndWait(ctx, req)
+			ch <- result{ev, err}
+		}()
+		return ch
+	}
+
+	// acknowledged subscription
+	res := subscribe(&websocket.SubscriptionRequest{Event: websocket.EventSubscribe, Channel: websocket.ChanTicker, Symbol: "tBTCUSD"})
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	r := <-res
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	assert(t, &websocket.SubscribeEvent{SubID: "nonce1", Channel: "ticker", ChanID: 5, Symbol: "tBTCUSD"}, r.ev)
+
+	// rejected subscription
+	capacity := ws.AvailableCapacity()
+	res = subscribe(&websocket.SubscriptionRequest{Event: websocket.EventSubscribe, Channel: websocket.ChanTicker, Symbol: "tXXXUSD"})
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"error","msg":"symbol: invalid","code":10001,"channel":"ticker","symbol":"tXXXUSD","subId":"nonce2"}`)
+	r = <-res
+	if r.err == nil {
+		t.Fatal("expected subscription error")
+	}
+	if !errors.Is(r.err, websocket.ErrUnknownPair) {
+		t.Fatalf("expected ErrUnknownPair, got %v", r.err)
+	}
+	if errors.Is(r.err, websocket.ErrAlreadySubscribed) {
+		t.Fatalf("did not expect ErrAlreadySubscribed for %v", r.err)
+	}
+	var evErr *websocket.EventError
+	if !errors.As(r.err, &evErr) {
+		t.Fatalf("expected *EventError, got %T", r.err)
+	}
+	assert(t, "tXXXUSD", evErr.Event.Symbol)
+	// the rejected subscription does not take capacity
+	assert(t, capacity, ws.AvailableCapacity())
+}
+
+func TestSubscribeManyConnectionLimit(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.CapacityPerConnection = 3
+	p.ConnectionLimiter = websocket.NewConnectionRateLimiter(2, time.Millisecond*300)
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	tickers := []string{"tBTCUSD", "tETHUSD", "tLTCUSD", "tEOSUSD", "tXRPUSD", "tTRXUSD", "tVETUSD"}
+	reqs := make([]*websocket.SubscriptionRequest, 0, len(tickers))
+	for _, ticker := range tickers {
+		reqs = append(reqs, &websocket.SubscriptionRequest{Event: websocket.EventSubscribe, Channel: websocket.ChanTicker, Symbol: ticker})
+	}
+	start := time.Now()
+	ids, err := ws.SubscribeMany(context.Background(), reqs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, len(tickers), len(ids))
+	// the most available selector keeps a free channel before it opens a new
+	// connection: 3 requests on the open socket and 2 on each new connection
+	assert(t, 3, ws.ConnectionCount())
+	assert(t, 3, async.SentCount())
+	// the third connection exceeds the limit of 2 connections per period
+	if elapsed := time.Since(start); elapsed < time.Millisecond*200 {
+		t.Fatalf("expected the third connection to be throttled, took %s", elapsed)
+	}
+
+	progress := make([]*websocket.SubscribeProgress, 0)
+	throttled := 0
+	for len(progress) < 3 {
+		ev, err := listener.nextLifecycleEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e := ev.(type) {
+		case *websocket.SubscribeProgress:
+			progress = append(progress, e)
+		case *websocket.ConnectionThrottled:
+			assert(t, websocket.SocketId(2), e.SocketId)
+			throttled++
+		}
+	}
+	if throttled == 0 {
+		t.Fatal("expected a ConnectionThrottled event")
+	}
+	assert(t, &websocket.SubscribeProgress{SocketId: 0, Subscribed: 3, Total: 7}, progress[0])
+	assert(t, &websocket.SubscribeProgress{SocketId: 1, Subscribed: 5, Total: 7}, progress[1])
+	assert(t, &websocket.SubscribeProgress{SocketId: 2, Subscribed: 7, Total: 7}, progress[2])
+}
+
+func TestConcurrentNewConnections(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ConnectionLimiter = websocket.NewConnectionRateLimiter(2, time.Millisecond*200)
+	ws := websocket.NewWithParamsAsyncFactory(p, newTestAsyncFactory(async))
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// connections throttled at the same time are assigned their own sockets
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- ws.StartNewConnection()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert(t, 4, ws.ConnectionCount())
+}
+
+func TestPingLatency(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	params := websocket.NewDefaultParameters()
+	params.PingInterval = time.Millisecond * 100
+	params.PongTimeout = time.Second
+	params.AutoReconnect = false
+	ws := websocket.NewWithParamsAsyncFactoryNonce(params, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	// socket connected
+	if _, err := listener.nextLifecycleEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if ws.Latency() != 0 {
+		t.Fatalf("expected no latency before the first pong, got %s", ws.Latency())
+	}
+
+	// answer the first ping
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	async.mutex.Lock()
+	ping, ok := async.Sent[0].(*websocket.PingRequest)
+	async.mutex.Unlock()
+	if !ok {
+		t.Fatalf("expected ping request, got %#v", async.Sent[0])
+	}
+	if ping.Event != "ping" || ping.Cid != 1 {
+		t.Fatalf("unexpected ping request: %#v", ping)
+	}
+	async.Publish(`{"event":"pong","ts":1511545528111,"cid":1}`)
+	pong, err := listener.nextPongEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.PongEvent{Cid: 1, TS: 1511545528111}, pong)
+
+	rtt, err := ws.SocketLatency(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rtt <= 0 || ws.Latency() != rtt {
+		t.Fatalf("expected a positive round trip on the only socket, got %s (client %s)", rtt, ws.Latency())
+	}
+	// the pong timestamp synchronizes the server clock
+	expOffset := time.Until(time.Unix(0, 1511545528111*int64(time.Millisecond)))
+	if diff := ws.Clock().Offset() - expOffset; !ws.Clock().Synced() || diff > time.Second || diff < -time.Second {
+		t.Fatalf("expected clock offset %s, got %s", expOffset, ws.Clock().Offset())
+	}
+
+	// unanswered pings disconnect the socket
+	ev, err := listener.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	disconnected, ok := ev.(*websocket.SocketDisconnected)
+	if !ok {
+		t.Fatalf("expected socket disconnected event, got %#v", ev)
+	}
+	if disconnected.Error != websocket.ErrPongTimeout {
+		t.Fatalf("expected pong timeout, got %v", disconnected.Error)
+	}
+}
@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+	"github.com/bitfinexcom/bitfinex-api-go/v2/websocket"
+)
+
+// legacyOrderbook is the sorted slice orderbook implementation used before
+// websocket.Orderbook moved to ordered price levels, kept as a benchmark baseline.
+type legacyOrderbook struct {
+	lock sync.RWMutex
+	bids []*bitfinex.BookUpdate
+	asks []*bitfinex.BookUpdate
+}
+
+func (ob *legacyOrderbook) SetWithSnapshot(bs *bitfinex.BookUpdateSnapshot) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	ob.bids = make([]*bitfinex.BookUpdate, 0)
+	ob.asks = make([]*bitfinex.BookUpdate, 0)
+	for _, order := range bs.Snapshot {
+		if order.Side == bitfinex.Bid {
+			ob.bids = append(ob.bids, order)
+		} else {
+			ob.asks = append(ob.asks, order)
+		}
+	}
+}
+
+func (ob *legacyOrderbook) UpdateWith(bu *bitfinex.BookUpdate) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	side := &ob.asks
+	if bu.Side == bitfinex.Bid {
+		side = &ob.bids
+	}
+	if len(*side) == 0 {
+		*side = append(*side, bu)
+		return
+	}
+	for index, sOrder := range *side {
+		if sOrder.Price == bu.Price {
+			if index+1 > len(*side) {
+				return
+			}
+			*side = append((*side)[:index], (*side)[index+1:]...)
+			if bu.Count <= 0 {
+				return
+			}
+		}
+	}
+	*side = append(*side, bu)
+	sort.Slice(*side, func(i, j int) bool {
+		if bu.Side == bitfinex.Ask {
+			return (*side)[i].Price < (*side)[j].Price
+		}
+		return (*side)[i].Price > (*side)[j].Price
+	})
+}
+
+func (ob *legacyOrderbook) Checksum() uint32 {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	var checksumItems []string
+	for i := 0; i < 25; i++ {
+		if len(ob.bids) > i {
+			checksumItems = append(checksumItems, ob.bids[i].PriceJsNum.String())
+			checksumItems = append(checksumItems, ob.bids[i].AmountJsNum.String())
+		}
+		if len(ob.asks) > i {
+			checksumItems = append(checksumItems, ob.asks[i].PriceJsNum.String())
+			checksumItems = append(checksumItems, ob.asks[i].AmountJsNum.String())
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(strings.Join(checksumItems, ":")))
+}
+
+type benchBook interface {
+	SetWithSnapshot(bs *bitfinex.BookUpdateSnapshot)
+	UpdateWith(bu *bitfinex.BookUpdate)
+	Checksum() uint32
+}
+
+func newBookEntry(price float64, count int64, amount float64) *bitfinex.BookUpdate {
+	side := bitfinex.Bid
+	if amount < 0 {
+		side = bitfinex.Ask
+	}
+	return &bitfinex.BookUpdate{
+		Symbol:      "tBTCUSD",
+		Price:       price,
+		PriceJsNum:  json.Number(strconv.FormatFloat(price, 'f', -1, 64)),
+		Count:       count,
+		Amount:      math.Abs(amount),
+		AmountJsNum: json.Number(strconv.FormatFloat(amount, 'f', -1, 64)),
+		Side:        side,
+	}
+}
+
+// bookFixture creates a snapshot with the given levels per side around a mid
+// price of 10000, followed by random updates and deletes near the spread.
+func bookFixture(levels, updates int) (*bitfinex.BookUpdateSnapshot, []*bitfinex.BookUpdate) {
+	rnd := rand.New(rand.NewSource(42))
+	snapshot := &bitfinex.BookUpdateSnapshot{}
+	for i := 1; i <= levels; i++ {
+		snapshot.Snapshot = append(snapshot.Snapshot, newBookEntry(10000-float64(i), 1, 1+float64(i)))
+		snapshot.Snapshot = append(snapshot.Snapshot, newBookEntry(10000+float64(i), 1, -1-float64(i)))
+	}
+	// the API only deletes existing price levels
+	present := make(map[float64]bool)
+	for _, bu := range snapshot.Snapshot {
+		present[bu.Price] = true
+	}
+	stream := make([]*bitfinex.BookUpdate, 0, updates)
+	for i := 0; i < updates; i++ {
+		price := 10000 - float64(1+rnd.Intn(levels))
+		amount := float64(1+rnd.Intn(100)) / 10
+		if rnd.Intn(2) == 0 {
+			price = 10000 + float64(1+rnd.Intn(levels))
+			amount = -amount
+		}
+		count := int64(rnd.Intn(3))
+		if count == 0 && !present[price] {
+			count = 1
+		}
+		present[price] = count > 0
+		stream = append(stream, newBookEntry(price, count, amount))
+	}
+	return snapshot, stream
+}
+
+func TestOrderbookMatchesLegacyImplementation(t *testing.T) {
+	snapshot, updates := bookFixture(250, 5000)
+	legacy := &legacyOrderbook{}
+	ob := &websocket.Orderbook{}
+	legacy.SetWithSnapshot(snapshot)
+	ob.SetWithSnapshot(snapshot)
+	for i, bu := range updates {
+		legacy.UpdateWith(bu)
+		ob.UpdateWith(bu)
+		if legacy.Checksum() != ob.Checksum() {
+			t.Fatalf("checksum mismatch after update %d", i)
+		}
+	}
+	bids := ob.Bids()
+	if len(bids) != len(legacy.bids) {
+		t.Fatalf("expected %d bids, got %d", len(legacy.bids), len(bids))
+	}
+	for i := range bids {
+		assert(t, legacy.bids[i], &bids[i])
+	}
+	asks := ob.Asks()
+	if len(asks) != len(legacy.asks) {
+		t.Fatalf("expected %d asks, got %d", len(legacy.asks), len(asks))
+	}
+	for i := range asks {
+		assert(t, legacy.asks[i], &asks[i])
+	}
+	top := ob.TopBids(25)
+	if len(top) != 25 {
+		t.Fatalf("expected 25 top bids, got %d", len(top))
+	}
+	assert(t, &bids[24], &top[24])
+}
+
+func benchmarkUpdates(b *testing.B, book benchBook, levels int) {
+	snapshot, updates := bookFixture(levels, 10000)
+	book.SetWithSnapshot(snapshot)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		book.UpdateWith(updates[i%len(updates)])
+	}
+}
+
+func benchmarkChecksum(b *testing.B, book benchBook, levels int) {
+	snapshot, updates := bookFixture(levels, 10000)
+	book.SetWithSnapshot(snapshot)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		book.UpdateWith(updates[i%len(updates)])
+		book.Checksum()
+	}
+}
+
+func BenchmarkOrderbookUpdate25(b *testing.B) {
+	benchmarkUpdates(b, &websocket.Orderbook{}, 25)
+}
+
+func BenchmarkLegacyOrderbookUpdate25(b *testing.B) {
+	benchmarkUpdates(b, &legacyOrderbook{}, 25)
+}
+
+func BenchmarkOrderbookUpdate250(b *testing.B) {
+	benchmarkUpdates(b, &websocket.Orderbook{}, 250)
+}
+
+func BenchmarkLegacyOrderbookUpdate250(b *testing.B) {
+	benchmarkUpdates(b, &legacyOrderbook{}, 250)
+}
+
+func BenchmarkOrderbookUpdateChecksum250(b *testing.B) {
+	benchmarkChecksum(b, &websocket.Orderbook{}, 250)
+}
+
+func BenchmarkLegacyOrderbookUpdateChecksum250(b *testing.B) {
+	benchmarkChecksum(b, &legacyOrderbook{}, 250)
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+	"github.com/bitfinexcom/bitfinex-api-go/v2/websocket"
+)
+
+func assertFloat(t *testing.T, exp, act float64) {
+	if math.Abs(exp-act) > 1e-9 {
+		t.Fatalf("expected %f, got %f", exp, act)
+	}
+}
+
+func TestOrderbookAnalytics(t *testing.T) {
+	ob := &websocket.Orderbook{}
+	if _, err := ob.Mid(); err != websocket.ErrEmptyBookSide {
+		t.Fatalf("expected empty book error, got %v", err)
+	}
+	ob.SetWithSnapshot(&bitfinex.BookUpdateSnapshot{Snapshot: []*bitfinex.BookUpdate{
+		newBookEntry(99, 1, 1),
+		newBookEntry(98, 1, 2),
+		newBookEntry(97, 1, 3),
+		newBookEntry(101, 1, -1),
+		newBookEntry(102, 1, -1),
+		newBookEntry(105, 1, -2),
+	}})
+
+	bid, err := ob.BestBid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat(t, 99, bid.Price)
+	ask, err := ob.BestAsk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat(t, 101, ask.Price)
+	mid, _ := ob.Mid()
+	assertFloat(t, 100, mid)
+	spread, _ := ob.Spread()
+	assertFloat(t, 2, spread)
+	bps, _ := ob.SpreadBps()
+	assertFloat(t, 200, bps)
+
+	assertFloat(t, 3, ob.DepthToPrice(bitfinex.Bid, 98))
+	assertFloat(t, 2, ob.DepthToPrice(bitfinex.Ask, 104))
+
+	// 101 + 102 + half of the 105 level
+	depth, err := ob.DepthToNotional(bitfinex.Ask, 101+102+52.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat(t, 2.5, depth)
+	if _, err := ob.DepthToNotional(bitfinex.Ask, 1000); err != websocket.ErrInsufficientDepth {
+		t.Fatalf("expected insufficient depth error, got %v", err)
+	}
+
+	avg, notional, err := ob.SweepCost(bitfinex.Ask, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat(t, 101+102+105, notional)
+	assertFloat(t, (101+102+105)/3.0, avg)
+	if _, _, err := ob.SweepCost(bitfinex.Bid, 10); err != websocket.ErrInsufficientDepth {
+		t.Fatalf("expected insufficient depth error, got %v", err)
+	}
+
+	price, err := ob.PriceAtSize(bitfinex.Bid, 2.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat(t, 98, price)
+
+	// top 2 levels: bids 3, asks 2
+	imbalance, err := ob.Imbalance(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat(t, 0.2, imbalance)
+}
+
+func TestOrderbookObservers(t *testing.T) {
+	ob := &websocket.Orderbook{}
+	events := make([]*websocket.OrderbookEvent, 0)
+	remove := ob.Observe(func(ev *websocket.OrderbookEvent) {
+		// the book can be read from within the callback
+		ob.Bids()
+		events = append(events, ev)
+	})
+
+	ob.SetWithSnapshot(&bitfinex.BookUpdateSnapshot{Snapshot: []*bitfinex.BookUpdate{
+		newBookEntry(99, 1, 1),
+		newBookEntry(98, 1, 2),
+		newBookEntry(101, 1, -1),
+	}})
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	assert(t, true, events[0].Snapshot)
+	assert(t, true, events[0].TopOfBookChanged)
+	if len(events[0].Changes) != 3 {
+		t.Fatalf("expected 3 level changes, got %d", len(events[0].Changes))
+	}
+	assert(t, websocket.LevelAdded, events[0].Changes[0].Type)
+	assertFloat(t, 99, events[0].Changes[0].Price)
+
+	// change a level behind the top of book
+	ob.UpdateWith(newBookEntry(98, 2, 5))
+	assert(t, false, events[1].TopOfBookChanged)
+	assert(t, websocket.LevelChanged, events[1].Changes[0].Type)
+	assertFloat(t, 2, events[1].Changes[0].Previous.Amount)
+	assertFloat(t, 5, events[1].Changes[0].Current.Amount)
+
+	// remove the best bid
+	ob.UpdateWith(newBookEntry(99, 0, 1))
+	assert(t, true, events[2].TopOfBookChanged)
+	assert(t, websocket.LevelRemoved, events[2].Changes[0].Type)
+	assertFloat(t, 98, events[2].BestBid.Price)
+
+	// a snapshot with identical levels reports no changes
+	ob.SetWithSnapshot(&bitfinex.BookUpdateSnapshot{Snapshot: []*bitfinex.BookUpdate{
+		newBookEntry(98, 2, 5),
+		newBookEntry(101, 1, -1),
+	}})
+	assert(t, false, events[3].TopOfBookChanged)
+	if len(events[3].Changes) != 0 {
+		t.Fatalf("expected no level changes, got %d", len(events[3].Changes))
+	}
+
+	remove()
+	ob.UpdateWith(newBookEntry(97, 1, 1))
+	if len(events) != 4 {
+		t.Fatalf("expected no events after removing the observer, got %d", len(events))
+	}
+
+	// channel observers report dropped events with a gap
+	ch, removeChan := ob.ObserveChan(2)
+	ob.UpdateWith(newBookEntry(96, 1, 1))
+	ob.UpdateWith(newBookEntry(95, 1, 1))
+	ob.UpdateWith(newBookEntry(94, 1, 1))
+	if _, ok := (<-ch).(*websocket.MessageGap); !ok {
+		t.Fatal("expected gap event")
+	}
+	ev, ok := (<-ch).(*websocket.OrderbookEvent)
+	if !ok {
+		t.Fatal("expected orderbook event")
+	}
+	assertFloat(t, 94, ev.Changes[0].Price)
+	removeChan()
+	if _, ok := <-ch; ok {
+		t.Fatal("expected observer channel to be closed")
+	}
+}
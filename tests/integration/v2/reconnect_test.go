@@ -372,6 +372,57 @@ func TestHeartbeatTimeoutReconnectBlah(t *testing.T) {
 	assert(t, &expTickerSub, tickerSub)
 }
 
+func TestReconnectRequestedBlah(t *testing.T) {
+	setup(t, time.Second*10, true, false)
+
+	_, err := apiRecv.nextInfoEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiClient.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wsService.WaitForMessage(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	wsService.Broadcast(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	if _, err := apiRecv.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// platform asks to reconnect
+	wsService.Broadcast(`{"event":"info","code":20051,"msg":"Stopping. Please try to reconnect"}`)
+	if _, err := apiRecv.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		ev, err := apiRecv.nextLifecycleEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ev.(*websocket.SocketDisconnected); ok {
+			break
+		}
+	}
+	if err := wsService.WaitForClientCount(1); err != nil {
+		t.Fatal(err)
+	}
+	wsService.Broadcast(`{"event":"info","version":2}`)
+	if _, err := apiRecv.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// subscriptions are restored on the new connection
+	m, err := wsService.WaitForMessage(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if `{"subId":"nonce2","event":"subscribe","channel":"ticker","symbol":"tBTCUSD"}` != m {
+		t.Fatalf("did not expect to receive: %s", m)
+	}
+}
+
 func TestHeartbeatNoTimeoutDataBlah(t *testing.T) {
 	// create transport & nonce mocks
 	setup(t, time.Second, true, false)
@@ -441,3 +492,180 @@ func TestHeartbeatNoTimeoutDataBlah(t *testing.T) {
 		t.Fatal("expected client connected, client has disconnected")
 	}
 }
+
+func TestHeartbeatResubscribeStaleChannelBlah(t *testing.T) {
+	setup(t, time.Second, true, false)
+
+	_, err := apiRecv.nextInfoEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// socket connected
+	_, err = apiRecv.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = apiClient.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiClient.SubscribeTrades(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsService.Broadcast(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	wsService.Broadcast(`{"event":"subscribed","channel":"trades","chanId":6,"symbol":"tBTCUSD","subId":"nonce2","pair":"BTCUSD"}`)
+	for i := 0; i < 2; i++ {
+		if _, err := apiRecv.nextSubscriptionEvent(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// keep the trades channel alive while the ticker channel goes stale
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond * 200):
+				wsService.Broadcast(`[6,"hb"]`)
+			}
+		}
+	}()
+
+	ev, err := apiRecv.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, ok := ev.(*websocket.HeartbeatRecovery)
+	if !ok {
+		t.Fatalf("expected heartbeat recovery event, got %#v", ev)
+	}
+	if recovery.Action != websocket.HeartbeatResubscribe || recovery.Silent {
+		t.Fatalf("expected resubscribe of the stale channel, got %s (silent %t)", recovery.Action, recovery.Silent)
+	}
+	assert(t, &websocket.HeartbeatRecovery{SubID: "nonce1", ChanID: 5, Channel: "ticker", Symbol: "tBTCUSD", Stale: 1}, recovery)
+
+	// only the stale channel is resubscribed, on the same connection
+	m, err := wsService.WaitForMessage(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if `{"event":"unsubscribe","chanId":5}` != m {
+		t.Fatalf("did not expect to receive: %s", m)
+	}
+	m, err = wsService.WaitForMessage(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if `{"subId":"nonce3","event":"subscribe","channel":"ticker","symbol":"tBTCUSD"}` != m {
+		t.Fatalf("did not expect to receive: %s", m)
+	}
+	if !apiClient.IsConnected() {
+		t.Fatal("expected client connected, client has disconnected")
+	}
+}
+
+func TestReconnectLifecycleEventsBlah(t *testing.T) {
+	setup(t, time.Second*10, true, false)
+
+	_, err := apiRecv.nextInfoEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := apiRecv.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ev.(*websocket.SocketConnected); !ok {
+		t.Fatalf("expected SocketConnected, got %#v", ev)
+	}
+
+	_, err = apiClient.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsService.Broadcast(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	_, err = apiRecv.nextSubscriptionEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// abrupt disconnect
+	wsService.Stop()
+	ev, err = apiRecv.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ev.(*websocket.SocketDisconnected); !ok {
+		t.Fatalf("expected SocketDisconnected, got %#v", ev)
+	}
+	ev, err = apiRecv.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconnecting, ok := ev.(*websocket.Reconnecting)
+	if !ok {
+		t.Fatalf("expected Reconnecting, got %#v", ev)
+	}
+	assert(t, &websocket.Reconnecting{
+		Attempt:     1,
+		MaxAttempts: 15,
+		Delay:       time.Millisecond * 500,
+	}, reconnecting)
+
+	wsService = NewTestWsService(wsPort)
+	if err := wsService.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wsService.WaitForClientCount(1); err != nil {
+		t.Fatal(err)
+	}
+	wsService.Broadcast(`{"event":"info","version":2}`)
+
+	// skip failed attempts until the connection is re-established
+	for {
+		ev, err = apiRecv.nextLifecycleEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ev.(*websocket.Reconnecting); ok {
+			continue
+		}
+		if _, ok := ev.(*websocket.SocketConnected); !ok {
+			t.Fatalf("expected SocketConnected, got %#v", ev)
+		}
+		break
+	}
+	ev, err = apiRecv.nextLifecycleEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resubscribed, ok := ev.(*websocket.Resubscribed)
+	if !ok {
+		t.Fatalf("expected Resubscribed, got %#v", ev)
+	}
+	assert(t, &websocket.Resubscribed{Subscriptions: 1}, resubscribed)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := websocket.NewExponentialBackoff(time.Second, time.Second*10)
+	backoff.Jitter = 0
+	exp := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 8, time.Second * 10, time.Second * 10}
+	for i, d := range exp {
+		if act := backoff.Delay(i + 1); act != d {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, d, act)
+		}
+	}
+
+	backoff.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := backoff.Delay(2)
+		if d < time.Second || d > time.Second*3 {
+			t.Fatalf("jittered delay out of range: %s", d)
+		}
+	}
+}
@@ -76,16 +76,19 @@ func (s *TestWsService) WaitForClientCount(count int) error {
 	delay := time.Millisecond * 50
 	for i := 0; i < loops; i++ {
 		s.lock.RLock()
-		if s.totalClients == count {
+		total := s.totalClients
+		s.lock.RUnlock()
+		if total == count {
 			return nil
 		}
-		s.lock.RUnlock()
 		time.Sleep(delay)
 	}
 	return fmt.Errorf("client peer #%d did not connect", count)
 }
 
 func (s *TestWsService) TotalClientCount() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.totalClients
 }
 
@@ -112,6 +115,8 @@ func (s *TestWsService) Broadcast(msg string) {
 
 // ReceivedCount starts indexing clients at position 0.
 func (s *TestWsService) ReceivedCount(clientNum int) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	i := 0
 	for client := range s.clients {
 		if i == clientNum {
@@ -128,12 +133,14 @@ func (s *TestWsService) ReceivedCount(clientNum int) int {
 func (s *TestWsService) Received(clientNum int, msgNum int) (string, error) {
 	var client *client
 	i := 0
+	s.lock.RLock()
 	for client = range s.clients {
 		if i == clientNum {
 			break
 		}
 		i++
 	}
+	s.lock.RUnlock()
 	if client != nil {
 		client.lock.Lock()
 		defer client.lock.Unlock()
@@ -166,9 +173,9 @@ func (s *TestWsService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *TestWsService) Stop() {
-	//s.lock.RLock()
-	//defer s.lock.RUnlock()
 	s.listener.Close() // stop listening to http
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	for c := range s.clients {
 		c.Close()
 	}
@@ -193,11 +200,13 @@ func (s *TestWsService) serveWs(w http.ResponseWriter, r *http.Request) {
 		log.Print(err)
 		return
 	}
-	s.totalClients++
 	client := &client{parent: s, Conn: conn, send: make(chan []byte, 256), received: make([]string, 0)}
+	s.lock.Lock()
+	s.totalClients++
+	s.clients[client] = true
+	s.lock.Unlock()
 	go client.writePump()
 	go client.readPump()
-	s.clients[client] = true
 	if s.publishOnConnect != "" {
 		s.Broadcast(s.publishOnConnect)
 	}
@@ -207,27 +216,27 @@ func (s *TestWsService) loop() {
 	for {
 		select {
 		case client := <-s.register:
-			//s.lock.Lock()
+			s.lock.Lock()
 			s.clients[client] = true
-			//s.lock.Unlock()
+			s.lock.Unlock()
 		case client := <-s.unregister:
+			s.lock.Lock()
 			if _, ok := s.clients[client]; ok {
-				//s.lock.Lock()
 				delete(s.clients, client)
 				close(client.send)
-				//s.lock.Unlock()
 			}
+			s.lock.Unlock()
 		case msg := <-s.broadcast:
+			s.lock.Lock()
 			for client := range s.clients {
 				select {
 				case client.send <- msg:
 				default: // send failure
-					//s.lock.Lock()
 					close(client.send)
 					delete(s.clients, client)
-					//s.lock.Unlock()
 				}
 			}
+			s.lock.Unlock()
 		}
 	}
 }
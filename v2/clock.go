@@ -0,0 +1,94 @@
+package bitfinex
+
+import (
+	"sync"
+	"time"
+)
+
+// number of offset samples a ServerClock estimates the offset from
+const clockSamples = 8
+
+type clockSample struct {
+	offset time.Duration
+	bound  time.Duration // maximum error of the offset
+}
+
+// ServerClock estimates the offset of the local clock to the Bitfinex server
+// clock from server timestamps, i.e. websocket pongs and REST Date headers.
+// Share one ServerClock between the rest and websocket clients to combine
+// their samples. The offset is taken from the most accurate of the recent
+// samples; without samples the ServerClock returns the local time.
+type ServerClock struct {
+	lock    sync.RWMutex
+	samples []clockSample // ring of the recent samples
+	next    int
+	offset  time.Duration
+}
+
+// NewServerClock creates a clock without samples.
+func NewServerClock() *ServerClock {
+	return &ServerClock{
+		samples: make([]clockSample, 0, clockSamples),
+	}
+}
+
+// Observe records a server timestamp taken between the local times sent and
+// received, i.e. while a request was in flight. Resolution is the precision of
+// the timestamp, which is truncated to it, i.e. a second for a Date header.
+func (c *ServerClock) Observe(server time.Time, resolution time.Duration, sent, received time.Time) {
+	if received.Before(sent) {
+		sent, received = received, sent
+	}
+	rtt := received.Sub(sent)
+	sample := clockSample{
+		// assume the server took its timestamp halfway through the round trip
+		offset: server.Add(resolution / 2).Sub(sent.Add(rtt / 2)),
+		bound:  rtt/2 + resolution/2,
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.samples) < clockSamples {
+		c.samples = append(c.samples, sample)
+	} else {
+		c.samples[c.next] = sample
+	}
+	c.next = (c.next + 1) % clockSamples
+	best := c.samples[0]
+	for _, s := range c.samples[1:] {
+		if s.bound < best.bound {
+			best = s
+		}
+	}
+	c.offset = best.offset
+}
+
+// Offset returns the estimated difference of the server clock to the local
+// clock, positive if the server clock is ahead.
+func (c *ServerClock) Offset() time.Duration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.offset
+}
+
+// Synced returns true once the clock received a sample.
+func (c *ServerClock) Synced() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.samples) > 0
+}
+
+// Now returns the current server time.
+func (c *ServerClock) Now() time.Time {
+	return time.Now().Add(c.Offset())
+}
+
+// NowMts returns the current server time in milliseconds, i.e. the end of an
+// MTS based history query.
+func (c *ServerClock) NowMts() Mts {
+	return ToMts(c.Now())
+}
+
+// ToMts converts the time to milliseconds since the epoch.
+func ToMts(t time.Time) Mts {
+	return Mts(t.UnixNano() / int64(time.Millisecond))
+}
@@ -0,0 +1,61 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+	"github.com/bitfinexcom/bitfinex-api-go/v2/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandlesHistoryWithQuery(t *testing.T) {
+	t.Run("builds the query from the server clock", func(t *testing.T) {
+		// the server clock is an hour ahead of the local clock
+		offset := time.Hour
+		var end int64
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/candles/trade:1m:tBTCUSD/HIST", r.URL.Path)
+			assert.Equal(t, "GET", r.Method)
+			var err error
+			end, err = strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+			require.Nil(t, err)
+			w.Header().Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+			_, err = w.Write([]byte(`[[1594161600000,9300,9310,9320,9290,12.5]]`))
+			require.Nil(t, err)
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(handler))
+		defer server.Close()
+
+		c := rest.NewClientWithURL(server.URL)
+		require.False(t, c.Clock().Synced())
+		query := func() {
+			now := c.Clock().Now()
+			candles, err := c.Candles.HistoryWithQuery(
+				"tBTCUSD",
+				bitfinex.OneMinute,
+				bitfinex.ToMts(now.Add(-time.Hour)),
+				bitfinex.ToMts(now),
+				10,
+				bitfinex.OldestFirst,
+			)
+			require.Nil(t, err)
+			require.Len(t, candles.Snapshot, 1)
+		}
+
+		// the first response synchronizes the clock
+		query()
+		require.True(t, c.Clock().Synced())
+		assert.InDelta(t, float64(offset), float64(c.Clock().Offset()), float64(time.Second))
+
+		// later queries use the server time
+		query()
+		local := bitfinex.ToMts(time.Now())
+		assert.InDelta(t, float64(offset/time.Millisecond), float64(end-int64(local)), 2000)
+	})
+}
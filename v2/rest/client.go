@@ -32,6 +32,7 @@ type Client struct {
 	apiKey    string
 	apiSecret string
 	nonce     utils.NonceGenerator
+	clock     *bitfinex.ServerClock
 
 	// service providers
 	Candles     CandleService
@@ -108,6 +109,7 @@ func NewClientWithSynchronousURLNonce(sync Synchronous, url string, nonce utils.
 		Synchronous: sync,
 		nonce:       nonce,
 	}
+	c.WithClock(bitfinex.NewServerClock())
 	c.Orders = OrderService{Synchronous: c, requestFactory: c}
 	c.Book = BookService{Synchronous: c}
 	c.Candles = CandleService{Synchronous: c}
@@ -135,6 +137,22 @@ func (c *Client) Credentials(key string, secret string) *Client {
 	return c
 }
 
+// WithClock sets the server clock, i.e. to share it with the websocket client.
+// Responses of the HttpTransport update the clock with their Date header.
+func (c *Client) WithClock(clock *bitfinex.ServerClock) *Client {
+	c.clock = clock
+	if transport, ok := c.Synchronous.(*HttpTransport); ok {
+		transport.Clock = clock
+	}
+	return c
+}
+
+// Clock returns the server clock, which corrects the local time for MTS based
+// queries, i.e. Candles.HistoryWithQuery(..., start, c.Clock().NowMts(), ...).
+func (c *Client) Clock() *bitfinex.ServerClock {
+	return c.clock
+}
+
 // Request is a wrapper for standard http.Request.  Default method is POST with no data.
 type Request struct {
 	RefURL  string     // ref url
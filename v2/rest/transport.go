@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"time"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
 )
 
 type HttpTransport struct {
 	BaseURL    *url.URL
 	HTTPClient *http.Client
 	httpDo     func(c *http.Client, req *http.Request) (*http.Response, error)
+	// Clock receives the Date header of every response, if set
+	Clock      *bitfinex.ServerClock
 }
 
 func (h HttpTransport) Request(req Request) ([]interface{}, error) {
@@ -46,11 +51,13 @@ func (h HttpTransport) Request(req Request) ([]interface{}, error) {
 
 // Do executes API request created by NewRequest method or custom *http.Request.
 func (h HttpTransport) do(req *http.Request, v interface{}) (error) {
+	sent := time.Now()
 	resp, err := h.httpDo(h.HTTPClient, req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	h.observeDate(resp, sent, time.Now())
 
 	response := newResponse(resp)
 	err = checkResponse(response)
@@ -67,3 +74,15 @@ func (h HttpTransport) do(req *http.Request, v interface{}) (error) {
 
 	return nil
 }
+
+// observeDate samples the server clock from the Date header of the response
+func (h HttpTransport) observeDate(resp *http.Response, sent, received time.Time) {
+	if h.Clock == nil {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	h.Clock.Observe(date, time.Second, sent, received)
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"math"
 	"strings"
+	"time"
 
 	"github.com/bitfinexcom/bitfinex-api-go/pkg/convert"
 )
@@ -103,13 +104,44 @@ const (
 // Settings flags
 
 const (
-	Dec_s     int = 9
-	Time_s    int = 32
-	Timestamp int = 32768
-	Seq_all   int = 65536
-	Checksum  int = 131072
+	Dec_s        int = 8         // decimals as strings
+	Time_s       int = 32        // times as date strings
+	Timestamp    int = 32768     // adds a timestamp in milliseconds to each message
+	Seq_all      int = 65536     // adds sequence numbers to each message
+	Checksum     int = 131072    // sends a checksum after each book update
+	Bulk_updates int = 536870912 // sends book updates in bulk, as a list of updates
 )
 
+// UpdateTimestamp is embedded into the public websocket updates. With the
+// Timestamp flag enabled it holds the time the exchange sent the update and the
+// local time it was received, otherwise it is left empty.
+type UpdateTimestamp struct {
+	ServerMTS  int64     // server timestamp in milliseconds
+	ReceivedAt time.Time // local receive time
+}
+
+// Latency returns the time between the server sending and the client receiving
+// the update, or zero without a server timestamp. It compares the server clock
+// with the local clock, so any skew between the two is included and may exceed
+// the latency itself; use LatencyWith to correct for the skew.
+func (u UpdateTimestamp) Latency() time.Duration {
+	return u.LatencyWith(nil)
+}
+
+// LatencyWith returns the time between the server sending and the client
+// receiving the update, corrected by the offset of the given server clock, i.e.
+// the Clock of the websocket client. Without a clock it equals Latency.
+func (u UpdateTimestamp) LatencyWith(clock *ServerClock) time.Duration {
+	if u.ServerMTS == 0 || u.ReceivedAt.IsZero() {
+		return 0
+	}
+	received := u.ReceivedAt
+	if clock != nil {
+		received = received.Add(clock.Offset())
+	}
+	return received.Sub(time.Unix(0, u.ServerMTS*int64(time.Millisecond)))
+}
+
 type orderSide byte
 
 // OrderSide provides a typed set of order sides.
@@ -250,6 +282,11 @@ func (o *OrderNewRequest) ToJSON() ([]byte, error) {
 	return json.Marshal(o.EnrichedPayload())
 }
 
+// MultiOp returns the operation of the order within an OrderMultiOpRequest.
+func (o *OrderNewRequest) MultiOp() []interface{} {
+	return []interface{}{"on", o.EnrichedPayload()}
+}
+
 type OrderUpdateRequest struct {
 	ID            int64                  `json:"id"`
 	GID           int64                  `json:"gid,omitempty"`
@@ -321,6 +358,11 @@ func (o *OrderUpdateRequest) ToJSON() ([]byte, error) {
 	return json.Marshal(o.EnrichedPayload())
 }
 
+// MultiOp returns the operation of the update within an OrderMultiOpRequest.
+func (o *OrderUpdateRequest) MultiOp() []interface{} {
+	return []interface{}{"ou", o.EnrichedPayload()}
+}
+
 // OrderCancelRequest represents an order cancel request.
 // An order can be cancelled using the internal ID or a
 // combination of Client ID (CID) and the daten for the given
@@ -331,8 +373,8 @@ type OrderCancelRequest struct {
 	CIDDate string `json:"cid_date,omitempty"`
 }
 
-func (o *OrderCancelRequest) ToJSON() ([]byte, error) {
-	aux := struct {
+func (o *OrderCancelRequest) payload() interface{} {
+	return struct {
 		ID      int64  `json:"id,omitempty"`
 		CID     int64  `json:"cid,omitempty"`
 		CIDDate string `json:"cid_date,omitempty"`
@@ -341,8 +383,10 @@ func (o *OrderCancelRequest) ToJSON() ([]byte, error) {
 		CID:     o.CID,
 		CIDDate: o.CIDDate,
 	}
+}
 
-	return json.Marshal(aux)
+func (o *OrderCancelRequest) ToJSON() ([]byte, error) {
+	return json.Marshal(o.payload())
 }
 
 // MarshalJSON converts the order cancel object into the format required by the
@@ -355,7 +399,96 @@ func (o *OrderCancelRequest) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("[0, \"oc\", null, %s]", string(aux))), nil
 }
 
-// TODO: MultiOrderCancelRequest represents an order cancel request.
+// MultiOp returns the operation of the cancel within an OrderMultiOpRequest.
+func (o *OrderCancelRequest) MultiOp() []interface{} {
+	return []interface{}{"oc", o.payload()}
+}
+
+// OrderMultiCancelRequest cancels multiple orders at once. Orders can be
+// cancelled by their IDs, group IDs (GID), or client IDs (CID) together with
+// the date of the CID. Setting All cancels all orders.
+type OrderMultiCancelRequest struct {
+	OrderIDs       []int64
+	GroupOrderIDs  []int64
+	ClientOrderIDs []ClientOrderID
+	All            bool
+}
+
+// ClientOrderID identifies an order by its client ID and the date (YYYY-MM-DD)
+// the order was created at.
+type ClientOrderID struct {
+	CID     int64
+	CIDDate string
+}
+
+func (o *OrderMultiCancelRequest) payload() interface{} {
+	pld := struct {
+		ID  []int64         `json:"id,omitempty"`
+		GID []int64         `json:"gid,omitempty"`
+		CID [][]interface{} `json:"cid,omitempty"`
+		All int             `json:"all,omitempty"`
+	}{
+		ID:  o.OrderIDs,
+		GID: o.GroupOrderIDs,
+	}
+	for _, cid := range o.ClientOrderIDs {
+		pld.CID = append(pld.CID, []interface{}{cid.CID, cid.CIDDate})
+	}
+	if o.All {
+		pld.All = 1
+	}
+	return pld
+}
+
+func (o *OrderMultiCancelRequest) ToJSON() ([]byte, error) {
+	return json.Marshal(o.payload())
+}
+
+// MarshalJSON converts the multi cancel object into the format required by the
+// bitfinex websocket service.
+func (o *OrderMultiCancelRequest) MarshalJSON() ([]byte, error) {
+	aux, err := o.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("[0, \"oc_multi\", null, %s]", string(aux))), nil
+}
+
+// MultiOp returns the operation of the multi cancel within an OrderMultiOpRequest.
+func (o *OrderMultiCancelRequest) MultiOp() []interface{} {
+	return []interface{}{"oc_multi", o.payload()}
+}
+
+// OrderOp is a single operation of an OrderMultiOpRequest. It is implemented by
+// OrderNewRequest, OrderUpdateRequest, OrderCancelRequest and OrderMultiCancelRequest.
+type OrderOp interface {
+	MultiOp() []interface{}
+}
+
+// OrderMultiOpRequest submits several order operations in a single message,
+// i.e. to replace all orders of a ladder at once. The operations are executed
+// in the given order.
+type OrderMultiOpRequest struct {
+	Ops []OrderOp
+}
+
+func (o *OrderMultiOpRequest) ToJSON() ([]byte, error) {
+	ops := make([][]interface{}, 0, len(o.Ops))
+	for _, op := range o.Ops {
+		ops = append(ops, op.MultiOp())
+	}
+	return json.Marshal(ops)
+}
+
+// MarshalJSON converts the multi op object into the format required by the
+// bitfinex websocket service.
+func (o *OrderMultiOpRequest) MarshalJSON() ([]byte, error) {
+	aux, err := o.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("[0, \"ox_multi\", null, %s]", string(aux))), nil
+}
 
 type Heartbeat struct {
 	//ChannelIDs []int64
@@ -616,6 +749,7 @@ func (o *ClaimPositionRequest) ToJSON() ([]byte, error) {
 
 // Trade represents a trade on the public data feed.
 type Trade struct {
+	UpdateTimestamp
 	Pair   string
 	ID     int64
 	MTS    int64
@@ -650,6 +784,7 @@ func NewTradeFromRaw(pair string, raw []interface{}) (o *Trade, err error) {
 }
 
 type TradeSnapshot struct {
+	UpdateTimestamp
 	Snapshot []*Trade
 }
 
@@ -1400,6 +1535,12 @@ type Notification struct {
 	Text       string
 }
 
+// NotificationSnapshot holds the notifications of the operations of a multi-op
+// request, in the order of the operations.
+type NotificationSnapshot struct {
+	Snapshot []*Notification
+}
+
 func NewNotificationFromRaw(raw []interface{}) (o *Notification, err error) {
 	if len(raw) < 8 {
 		return o, fmt.Errorf("data slice too short for notification: %#v", raw)
@@ -1455,6 +1596,29 @@ func NewNotificationFromRaw(raw []interface{}) (o *Notification, err error) {
 			}
 			orderCancel := OrderCancel(*oc)
 			o.NotifyInfo = &orderCancel
+		case "oc_multi-req":
+			// the cancelled orders
+			os := &OrderSnapshot{Snapshot: make([]*Order, 0)}
+			if len(nraw) > 0 {
+				os, err = NewOrderSnapshotFromRaw(nraw)
+				if err != nil {
+					return o, err
+				}
+			}
+			o.NotifyInfo = os
+		case "ox_multi-req":
+			// one notification per operation
+			ns := &NotificationSnapshot{Snapshot: make([]*Notification, 0, len(nraw))}
+			for _, v := range nraw {
+				if l, ok := v.([]interface{}); ok {
+					n, err := NewNotificationFromRaw(l)
+					if err != nil {
+						return o, err
+					}
+					ns.Snapshot = append(ns.Snapshot, n)
+				}
+			}
+			o.NotifyInfo = ns
 		case "fon-req":
 			fon, err := NewOfferFromRaw(nraw)
 			if err != nil {
@@ -1489,6 +1653,7 @@ func NewNotificationFromRaw(raw []interface{}) (o *Notification, err error) {
 }
 
 type Ticker struct {
+	UpdateTimestamp
 	Symbol          string
 	Frr             float64
 	Bid             float64
@@ -1507,6 +1672,7 @@ type Ticker struct {
 
 type TickerUpdate Ticker
 type TickerSnapshot struct {
+	UpdateTimestamp
 	Snapshot []*Ticker
 }
 
@@ -1606,6 +1772,7 @@ const (
 
 // BookUpdate represents an order book price update.
 type BookUpdate struct {
+	UpdateTimestamp
 	ID          int64       // the book update ID, optional
 	Symbol      string      // book symbol
 	Price       float64     // updated price
@@ -1618,6 +1785,7 @@ type BookUpdate struct {
 }
 
 type BookUpdateSnapshot struct {
+	UpdateTimestamp
 	Snapshot []*BookUpdate
 }
 
@@ -1698,7 +1866,104 @@ func NewBookUpdateFromRaw(symbol, precision string, data []interface{}, raw_numb
 	return
 }
 
+// IsFundingSymbol checks if the symbol refers to a funding currency, i.e. fUSD
+func IsFundingSymbol(symbol string) bool {
+	return strings.HasPrefix(symbol, FundingPrefix)
+}
+
+// FundingBookUpdate represents an order book entry of a funding symbol.
+type FundingBookUpdate struct {
+	UpdateTimestamp
+	ID          int64       // the funding offer ID of raw books, optional
+	Symbol      string      // book symbol
+	Rate        float64     // updated rate
+	RateJsNum   json.Number // updated rate as json.Number
+	Period      int64       // offer period in days
+	Count       int64       // updated count, optional
+	Amount      float64     // updated amount
+	AmountJsNum json.Number // updated amount as json.Number
+	Side        OrderSide   // side
+	Action      BookAction  // action (add/remove)
+}
+
+type FundingBookUpdateSnapshot struct {
+	UpdateTimestamp
+	Snapshot []*FundingBookUpdate
+}
+
+func NewFundingBookUpdateSnapshotFromRaw(symbol, precision string, raw [][]float64, raw_numbers interface{}) (*FundingBookUpdateSnapshot, error) {
+	if len(raw) <= 0 {
+		return nil, fmt.Errorf("data slice too short for funding book snapshot: %#v", raw)
+	}
+	snap := make([]*FundingBookUpdate, len(raw))
+	for i, f := range raw {
+		b, err := NewFundingBookUpdateFromRaw(symbol, precision, ToInterface(f), raw_numbers.([]interface{})[i])
+		if err != nil {
+			return nil, err
+		}
+		snap[i] = b
+	}
+	return &FundingBookUpdateSnapshot{Snapshot: snap}, nil
+}
+
+// NewFundingBookUpdateFromRaw creates a new funding book update object from raw data.
+// raw book updates [offer ID, period, rate, amount], aggregated book updates [rate, period, count, amount].
+// Offers (positive amounts) are asks, bids carry negative amounts.
+func NewFundingBookUpdateFromRaw(symbol, precision string, data []interface{}, raw_numbers interface{}) (b *FundingBookUpdate, err error) {
+	if len(data) < 4 {
+		return b, fmt.Errorf("data slice too short for funding book update, expected %d got %d: %#v", 4, len(data), data)
+	}
+	var rate float64
+	var rate_num json.Number
+	var id, cnt int64
+	raw_num_array := raw_numbers.([]interface{})
+	period := convert.I64ValOrZero(data[1])
+	amt := convert.F64ValOrZero(data[3])
+	amt_num := convert.FloatToJsonNumber(raw_num_array[3])
+
+	var actionCtrl float64
+	if IsRawBook(precision) {
+		// [ID, period, rate, amount]
+		id = convert.I64ValOrZero(data[0])
+		rate = convert.F64ValOrZero(data[2])
+		rate_num = convert.FloatToJsonNumber(raw_num_array[2])
+		actionCtrl = rate
+	} else {
+		// [rate, period, count, amount]
+		rate = convert.F64ValOrZero(data[0])
+		rate_num = convert.FloatToJsonNumber(raw_num_array[0])
+		cnt = convert.I64ValOrZero(data[2])
+		actionCtrl = float64(cnt)
+	}
+
+	side := Ask
+	if amt < 0 {
+		side = Bid
+	}
+
+	action := BookUpdateEntry
+	if actionCtrl <= 0 {
+		action = BookRemoveEntry
+	}
+
+	b = &FundingBookUpdate{
+		ID:          id,
+		Symbol:      symbol,
+		Rate:        math.Abs(rate),
+		RateJsNum:   rate_num,
+		Period:      period,
+		Count:       cnt,
+		Amount:      math.Abs(amt),
+		AmountJsNum: amt_num,
+		Side:        side,
+		Action:      action,
+	}
+
+	return
+}
+
 type Candle struct {
+	UpdateTimestamp
 	Symbol     string
 	Resolution CandleResolution
 	MTS        int64
@@ -1710,6 +1975,7 @@ type Candle struct {
 }
 
 type CandleSnapshot struct {
+	UpdateTimestamp
 	Snapshot []*Candle
 }
 
@@ -2006,6 +2272,7 @@ type Stat struct {
 }
 
 type DerivativeStatusSnapshot struct {
+	UpdateTimestamp
 	Snapshot []*DerivativeStatus
 }
 
@@ -2016,6 +2283,7 @@ const (
 )
 
 type DerivativeStatus struct {
+	UpdateTimestamp
 	Symbol               string
 	MTS                  int64
 	Price                float64
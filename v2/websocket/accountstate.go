@@ -0,0 +1,411 @@
+package websocket
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// AccountEntity identifies a collection of the AccountState.
+type AccountEntity int
+
+const (
+	AccountOrders AccountEntity = iota
+	AccountPositions
+	AccountWallets
+	AccountFundingOffers
+	AccountFundingCredits
+	AccountFundingLoans
+)
+
+func (e AccountEntity) String() string {
+	switch e {
+	case AccountOrders:
+		return "orders"
+	case AccountPositions:
+		return "positions"
+	case AccountWallets:
+		return "wallets"
+	case AccountFundingOffers:
+		return "funding offers"
+	case AccountFundingCredits:
+		return "funding credits"
+	case AccountFundingLoans:
+		return "funding loans"
+	}
+	return "unknown"
+}
+
+// AccountAction describes how an AccountEntity changed.
+type AccountAction int
+
+const (
+	// AccountSnapshot replaced the whole collection, i.e. after authentication.
+	AccountSnapshot AccountAction = iota
+	// AccountUpdated added or updated an entry of the collection.
+	AccountUpdated
+	// AccountRemoved removed an entry of the collection.
+	AccountRemoved
+)
+
+func (a AccountAction) String() string {
+	switch a {
+	case AccountSnapshot:
+		return "snapshot"
+	case AccountUpdated:
+		return "updated"
+	case AccountRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// AccountChange is passed to the OnChange callbacks of the AccountState. Item
+// is a copy of the updated or removed entry, i.e. a *bitfinex.Order for
+// AccountOrders, and nil for snapshots.
+type AccountChange struct {
+	Entity AccountEntity
+	Action AccountAction
+	Item   interface{}
+}
+
+// AccountState is a local copy of the open orders, positions, wallets, funding
+// offers, credits and loans of the account, maintained from the snapshots and
+// updates of the authenticated channel. The snapshots sent after every
+// (re-)authentication replace the respective collection, so the state is
+// rebuilt after reconnects. Queries return copies and are safe for concurrent
+// use.
+type AccountState struct {
+	lock      sync.RWMutex
+	orders    map[int64]*bitfinex.Order
+	positions map[string]*bitfinex.Position // by symbol
+	wallets   map[string]*bitfinex.Wallet   // by type and currency
+	offers    map[int64]*bitfinex.Offer
+	credits   map[int64]*bitfinex.Credit
+	loans     map[int64]*bitfinex.Loan
+
+	callbackLock sync.RWMutex
+	callbacks    map[int]func(*AccountChange)
+	nextCallback int
+}
+
+func newAccountState() *AccountState {
+	return &AccountState{
+		orders:    make(map[int64]*bitfinex.Order),
+		positions: make(map[string]*bitfinex.Position),
+		wallets:   make(map[string]*bitfinex.Wallet),
+		offers:    make(map[int64]*bitfinex.Offer),
+		credits:   make(map[int64]*bitfinex.Credit),
+		loans:     make(map[int64]*bitfinex.Loan),
+		callbacks: make(map[int]func(*AccountChange)),
+	}
+}
+
+func walletKey(walletType, currency string) string {
+	return walletType + ":" + currency
+}
+
+// OnChange registers a callback which is invoked after every change of the
+// state and returns a function to remove it. The callback is invoked from the
+// socket's read routine, so it should return quickly.
+func (a *AccountState) OnChange(callback func(*AccountChange)) (remove func()) {
+	a.callbackLock.Lock()
+	defer a.callbackLock.Unlock()
+	id := a.nextCallback
+	a.nextCallback++
+	a.callbacks[id] = callback
+	return func() {
+		a.callbackLock.Lock()
+		defer a.callbackLock.Unlock()
+		delete(a.callbacks, id)
+	}
+}
+
+func (a *AccountState) notify(change *AccountChange) {
+	a.callbackLock.RLock()
+	callbacks := make([]func(*AccountChange), 0, len(a.callbacks))
+	for _, callback := range a.callbacks {
+		callbacks = append(callbacks, callback)
+	}
+	a.callbackLock.RUnlock()
+	for _, callback := range callbacks {
+		callback(change)
+	}
+}
+
+// snapshotTerms are the private snapshot messages, which are applied even if
+// they are empty
+var snapshotTerms = map[string]AccountEntity{
+	"os":  AccountOrders,
+	"ps":  AccountPositions,
+	"ws":  AccountWallets,
+	"fos": AccountFundingOffers,
+	"fcs": AccountFundingCredits,
+	"fls": AccountFundingLoans,
+}
+
+// clear empties the collection of an empty snapshot message
+func (a *AccountState) clear(term string) {
+	entity, ok := snapshotTerms[term]
+	if !ok {
+		return
+	}
+	a.lock.Lock()
+	switch entity {
+	case AccountOrders:
+		a.orders = make(map[int64]*bitfinex.Order)
+	case AccountPositions:
+		a.positions = make(map[string]*bitfinex.Position)
+	case AccountWallets:
+		a.wallets = make(map[string]*bitfinex.Wallet)
+	case AccountFundingOffers:
+		a.offers = make(map[int64]*bitfinex.Offer)
+	case AccountFundingCredits:
+		a.credits = make(map[int64]*bitfinex.Credit)
+	case AccountFundingLoans:
+		a.loans = make(map[int64]*bitfinex.Loan)
+	}
+	a.lock.Unlock()
+	a.notify(&AccountChange{Entity: entity, Action: AccountSnapshot})
+}
+
+// update applies a typed message of the authenticated channel
+func (a *AccountState) update(msg interface{}) {
+	var change *AccountChange
+	a.lock.Lock()
+	switch m := msg.(type) {
+	case *bitfinex.OrderSnapshot:
+		a.orders = make(map[int64]*bitfinex.Order)
+		for _, o := range m.Snapshot {
+			order := *o
+			a.orders[order.ID] = &order
+		}
+		change = &AccountChange{Entity: AccountOrders, Action: AccountSnapshot}
+	case *bitfinex.OrderNew:
+		order := bitfinex.Order(*m)
+		a.orders[order.ID] = &order
+		change = &AccountChange{Entity: AccountOrders, Action: AccountUpdated, Item: copyOrder(&order)}
+	case *bitfinex.OrderUpdate:
+		order := bitfinex.Order(*m)
+		a.orders[order.ID] = &order
+		change = &AccountChange{Entity: AccountOrders, Action: AccountUpdated, Item: copyOrder(&order)}
+	case *bitfinex.OrderCancel:
+		// cancelled or fully executed
+		order := bitfinex.Order(*m)
+		delete(a.orders, order.ID)
+		change = &AccountChange{Entity: AccountOrders, Action: AccountRemoved, Item: &order}
+	case *bitfinex.PositionSnapshot:
+		a.positions = make(map[string]*bitfinex.Position)
+		for _, p := range m.Snapshot {
+			position := *p
+			a.positions[position.Symbol] = &position
+		}
+		change = &AccountChange{Entity: AccountPositions, Action: AccountSnapshot}
+	case *bitfinex.PositionNew:
+		position := bitfinex.Position(*m)
+		a.positions[position.Symbol] = &position
+		change = &AccountChange{Entity: AccountPositions, Action: AccountUpdated, Item: copyPosition(&position)}
+	case *bitfinex.PositionUpdate:
+		position := bitfinex.Position(*m)
+		a.positions[position.Symbol] = &position
+		change = &AccountChange{Entity: AccountPositions, Action: AccountUpdated, Item: copyPosition(&position)}
+	case *bitfinex.PositionCancel:
+		position := bitfinex.Position(*m)
+		delete(a.positions, position.Symbol)
+		change = &AccountChange{Entity: AccountPositions, Action: AccountRemoved, Item: &position}
+	case *bitfinex.WalletSnapshot:
+		a.wallets = make(map[string]*bitfinex.Wallet)
+		for _, w := range m.Snapshot {
+			wallet := *w
+			a.wallets[walletKey(wallet.Type, wallet.Currency)] = &wallet
+		}
+		change = &AccountChange{Entity: AccountWallets, Action: AccountSnapshot}
+	case *bitfinex.WalletUpdate:
+		wallet := bitfinex.Wallet(*m)
+		a.wallets[walletKey(wallet.Type, wallet.Currency)] = &wallet
+		change = &AccountChange{Entity: AccountWallets, Action: AccountUpdated, Item: copyWallet(&wallet)}
+	case *bitfinex.FundingOfferSnapshot:
+		a.offers = make(map[int64]*bitfinex.Offer)
+		for _, o := range m.Snapshot {
+			offer := *o
+			a.offers[offer.ID] = &offer
+		}
+		change = &AccountChange{Entity: AccountFundingOffers, Action: AccountSnapshot}
+	case *bitfinex.FundingOfferNew:
+		offer := bitfinex.Offer(*m)
+		a.offers[offer.ID] = &offer
+		change = &AccountChange{Entity: AccountFundingOffers, Action: AccountUpdated, Item: copyOffer(&offer)}
+	case *bitfinex.FundingOfferUpdate:
+		offer := bitfinex.Offer(*m)
+		a.offers[offer.ID] = &offer
+		change = &AccountChange{Entity: AccountFundingOffers, Action: AccountUpdated, Item: copyOffer(&offer)}
+	case *bitfinex.FundingOfferCancel:
+		offer := bitfinex.Offer(*m)
+		delete(a.offers, offer.ID)
+		change = &AccountChange{Entity: AccountFundingOffers, Action: AccountRemoved, Item: &offer}
+	case *bitfinex.FundingCreditSnapshot:
+		a.credits = make(map[int64]*bitfinex.Credit)
+		for _, c := range m.Snapshot {
+			credit := *c
+			a.credits[credit.ID] = &credit
+		}
+		change = &AccountChange{Entity: AccountFundingCredits, Action: AccountSnapshot}
+	case *bitfinex.FundingCreditNew:
+		credit := bitfinex.Credit(*m)
+		a.credits[credit.ID] = &credit
+		change = &AccountChange{Entity: AccountFundingCredits, Action: AccountUpdated, Item: copyCredit(&credit)}
+	case *bitfinex.FundingCreditUpdate:
+		credit := bitfinex.Credit(*m)
+		a.credits[credit.ID] = &credit
+		change = &AccountChange{Entity: AccountFundingCredits, Action: AccountUpdated, Item: copyCredit(&credit)}
+	case *bitfinex.FundingCreditCancel:
+		credit := bitfinex.Credit(*m)
+		delete(a.credits, credit.ID)
+		change = &AccountChange{Entity: AccountFundingCredits, Action: AccountRemoved, Item: &credit}
+	case *bitfinex.FundingLoanSnapshot:
+		a.loans = make(map[int64]*bitfinex.Loan)
+		for _, l := range m.Snapshot {
+			loan := *l
+			a.loans[loan.ID] = &loan
+		}
+		change = &AccountChange{Entity: AccountFundingLoans, Action: AccountSnapshot}
+	case *bitfinex.FundingLoanNew:
+		loan := bitfinex.Loan(*m)
+		a.loans[loan.ID] = &loan
+		change = &AccountChange{Entity: AccountFundingLoans, Action: AccountUpdated, Item: copyLoan(&loan)}
+	case *bitfinex.FundingLoanUpdate:
+		loan := bitfinex.Loan(*m)
+		a.loans[loan.ID] = &loan
+		change = &AccountChange{Entity: AccountFundingLoans, Action: AccountUpdated, Item: copyLoan(&loan)}
+	case *bitfinex.FundingLoanCancel:
+		loan := bitfinex.Loan(*m)
+		delete(a.loans, loan.ID)
+		change = &AccountChange{Entity: AccountFundingLoans, Action: AccountRemoved, Item: &loan}
+	}
+	a.lock.Unlock()
+	if change != nil {
+		a.notify(change)
+	}
+}
+
+func copyOrder(o *bitfinex.Order) *bitfinex.Order          { c := *o; return &c }
+func copyPosition(p *bitfinex.Position) *bitfinex.Position { c := *p; return &c }
+func copyWallet(w *bitfinex.Wallet) *bitfinex.Wallet       { c := *w; return &c }
+func copyOffer(o *bitfinex.Offer) *bitfinex.Offer          { c := *o; return &c }
+func copyCredit(c *bitfinex.Credit) *bitfinex.Credit       { cp := *c; return &cp }
+func copyLoan(l *bitfinex.Loan) *bitfinex.Loan             { c := *l; return &c }
+
+// Orders returns the open orders ordered by ID.
+func (a *AccountState) Orders() []*bitfinex.Order {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	orders := make([]*bitfinex.Order, 0, len(a.orders))
+	for _, o := range a.orders {
+		orders = append(orders, copyOrder(o))
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders
+}
+
+// Order returns the open order with the given ID.
+func (a *AccountState) Order(id int64) (*bitfinex.Order, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if o, ok := a.orders[id]; ok {
+		return copyOrder(o), true
+	}
+	return nil, false
+}
+
+// Positions returns the open positions ordered by symbol.
+func (a *AccountState) Positions() []*bitfinex.Position {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	positions := make([]*bitfinex.Position, 0, len(a.positions))
+	for _, p := range a.positions {
+		positions = append(positions, copyPosition(p))
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	return positions
+}
+
+// Position returns the open position of the symbol.
+func (a *AccountState) Position(symbol string) (*bitfinex.Position, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if p, ok := a.positions[symbol]; ok {
+		return copyPosition(p), true
+	}
+	return nil, false
+}
+
+// Wallets returns the wallets ordered by type and currency.
+func (a *AccountState) Wallets() []*bitfinex.Wallet {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	wallets := make([]*bitfinex.Wallet, 0, len(a.wallets))
+	for _, w := range a.wallets {
+		wallets = append(wallets, copyWallet(w))
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return walletKey(wallets[i].Type, wallets[i].Currency) < walletKey(wallets[j].Type, wallets[j].Currency)
+	})
+	return wallets
+}
+
+// Wallet returns the wallet of the given type, i.e. "exchange", and currency.
+func (a *AccountState) Wallet(walletType, currency string) (*bitfinex.Wallet, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if w, ok := a.wallets[walletKey(walletType, currency)]; ok {
+		return copyWallet(w), true
+	}
+	return nil, false
+}
+
+// FundingOffers returns the active funding offers ordered by ID.
+func (a *AccountState) FundingOffers() []*bitfinex.Offer {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	offers := make([]*bitfinex.Offer, 0, len(a.offers))
+	for _, o := range a.offers {
+		offers = append(offers, copyOffer(o))
+	}
+	sort.Slice(offers, func(i, j int) bool { return offers[i].ID < offers[j].ID })
+	return offers
+}
+
+// FundingCredits returns the funding credits ordered by ID.
+func (a *AccountState) FundingCredits() []*bitfinex.Credit {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	credits := make([]*bitfinex.Credit, 0, len(a.credits))
+	for _, c := range a.credits {
+		credits = append(credits, copyCredit(c))
+	}
+	sort.Slice(credits, func(i, j int) bool { return credits[i].ID < credits[j].ID })
+	return credits
+}
+
+// FundingLoans returns the funding loans ordered by ID.
+func (a *AccountState) FundingLoans() []*bitfinex.Loan {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	loans := make([]*bitfinex.Loan, 0, len(a.loans))
+	for _, l := range a.loans {
+		loans = append(loans, copyLoan(l))
+	}
+	sort.Slice(loans, func(i, j int) bool { return loans[i].ID < loans[j].ID })
+	return loans
+}
+
+// AccountState returns the account state maintained from the authenticated
+// channel, which requires Parameters.ManageAccountState.
+func (c *Client) AccountState() (*AccountState, error) {
+	if c.accountState == nil {
+		return nil, fmt.Errorf("account state is not managed, enable Parameters.ManageAccountState")
+	}
+	return c.accountState, nil
+}
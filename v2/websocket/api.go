@@ -3,6 +3,7 @@ package websocket
 import (
 	"context"
 	"fmt"
+	"strings"
 	"github.com/bitfinexcom/bitfinex-api-go/v2"
 )
 
@@ -15,34 +16,65 @@ type FlagRequest struct {
 
 // Send publishes a generic message to the Bitfinex API.
 func (c *Client) Send(ctx context.Context, msg interface{}) error {
-	socket, err := c.getSocket()
+	if c.InMaintenance() {
+		return ErrMaintenance
+	}
+	socket, err := c.selectSendSocket()
 	if err != nil {
 		return err
 	}
 	return socket.Asynchronous.Send(ctx, msg)
 }
 
-// Submit a request to enable the given flag
+// Submit a request to enable the given flag. Enabled flags are remembered and
+// applied to every new or reconnected socket.
 func (c *Client) EnableFlag(ctx context.Context, flag int) (string, error) {
+	c.mtx.Lock()
+	c.flags |= flag
+	c.mtx.Unlock()
+	return "", c.sendFlags(ctx)
+}
+
+// Submit a request to disable the given flag on all sockets
+func (c *Client) DisableFlag(ctx context.Context, flag int) (string, error) {
+	c.mtx.Lock()
+	c.flags &^= flag
+	c.mtx.Unlock()
+	return "", c.sendFlags(ctx)
+}
+
+// Get the enabled configuration flags
+func (c *Client) Flags() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.flags
+}
+
+func (c *Client) hasFlag(flag int) bool {
+	return c.Flags()&flag == flag
+}
+
+// sendFlags sends the enabled flags to all sockets, a conf request replaces
+// all previously enabled flags of the socket
+func (c *Client) sendFlags(ctx context.Context) error {
 	req := &FlagRequest{
 		Event: "conf",
-		Flags: flag,
+		Flags: c.Flags(),
 	}
-	// TODO enable flag on reconnect?
 	// create sublist to stop concurrent map read
-	socks := make([]*Socket, len(c.sockets))
 	c.mtx.RLock()
-	for i, socket := range c.sockets {
-		socks[i] = socket
+	socks := make([]*Socket, 0, len(c.sockets))
+	for _, socket := range c.sockets {
+		socks = append(socks, socket)
 	}
 	c.mtx.RUnlock()
 	for _, socket := range socks {
 		err := socket.Asynchronous.Send(ctx, req)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
-	return "", nil
+	return nil
 }
 
 // Gen the count of currently active websocket connections
@@ -61,11 +93,29 @@ func (c *Client) AvailableCapacity() int {
 // Start a new websocket connection. This function is only exposed in case you want to
 // implicitly add new connections otherwise connection management is already handled for you.
 func (c *Client) StartNewConnection() error {
-	return c.connectSocket(SocketId(c.ConnectionCount()))
+	_, err := c.startNewConnection(context.Background())
+	return err
 }
 
-func (c *Client) subscribeBySocket(ctx context.Context, socket *Socket, req *SubscriptionRequest) (string, error) {
-	c.subscriptions.add(socket.Id, req)
+func (c *Client) startNewConnection(ctx context.Context) (*Socket, error) {
+	// reserve the connection before the socket ID, connections waiting for the
+	// limiter concurrently must not be assigned the same ID
+	if err := c.waitConnectionLimit(ctx, SocketId(c.ConnectionCount())); err != nil {
+		return nil, err
+	}
+	socket := c.newSocket(0)
+	c.mtx.Lock()
+	socket.Id = SocketId(len(c.sockets))
+	c.sockets[socket.Id] = socket
+	c.mtx.Unlock()
+	if err := c.openSocket(socket); err != nil {
+		return nil, err
+	}
+	return socket, nil
+}
+
+func (c *Client) subscribeBySocket(ctx context.Context, socket *Socket, req *SubscriptionRequest, stream *SubscriptionStream) (string, error) {
+	c.subscriptions.add(socket.Id, req, stream)
 	err := socket.Asynchronous.Send(ctx, req)
 	if err != nil {
 		// propagate send error
@@ -76,18 +126,100 @@ func (c *Client) subscribeBySocket(ctx context.Context, socket *Socket, req *Sub
 
 // Submit a request to subscribe to the given SubscriptionRequuest
 func (c *Client) Subscribe(ctx context.Context, req *SubscriptionRequest) (string, error) {
-	if c.getTotalAvailableSocketCapacity() <= 1 {
-		err := c.StartNewConnection()
-		if err != nil {
-			return "", err
-		}
+	return c.subscribe(ctx, req, nil)
+}
+
+func (c *Client) subscribe(ctx context.Context, req *SubscriptionRequest, stream *SubscriptionStream) (string, error) {
+	if c.InMaintenance() {
+		return "", ErrMaintenance
 	}
-	// get socket with the highest available capacity
-	socket, err := c.getMostAvailableSocket()
+	if req.SubID == "" {
+		req.SubID = c.nonce.GetNonce()
+	}
+	socket, err := c.selectSubscriptionSocket(ctx, req)
 	if err != nil {
 		return "", err
 	}
-	return c.subscribeBySocket(ctx, socket, req)
+	return c.subscribeBySocket(ctx, socket, req, stream)
+}
+
+// SubscribeMany submits all subscription requests and returns their subscription
+// IDs. Capacity is planned up front: the SocketSelector places all requests on
+// the open sockets and the new connections they require, which are then opened
+// through the ConnectionLimiter. A SubscribeProgress event is published once the
+// requests of a socket have been sent.
+func (c *Client) SubscribeMany(ctx context.Context, reqs ...*SubscriptionRequest) ([]string, error) {
+	if c.InMaintenance() {
+		return nil, ErrMaintenance
+	}
+	// plan the sockets of all requests, new connections are planned with the
+	// IDs following the open sockets
+	selector := c.socketSelector()
+	states := c.socketStates()
+	opened := len(states)
+	next := SocketId(0)
+	if opened > 0 {
+		next = states[opened-1].Id + 1
+	}
+	plan := make(map[SocketId][]*SubscriptionRequest)
+	for _, req := range reqs {
+		id, ok := selector.Subscription(req, states)
+		for declines := 0; !ok; declines++ {
+			if c.parameters.CapacityPerConnection <= 0 {
+				return nil, fmt.Errorf("no capacity per connection to subscribe %d requests", len(reqs))
+			}
+			if declines == maxSelectorDeclines {
+				return nil, errSelectorDeclined(req)
+			}
+			states = append(states, SocketState{Id: next, Capacity: c.parameters.CapacityPerConnection})
+			next++
+			id, ok = selector.Subscription(req, states)
+		}
+		for i := range states {
+			if states[i].Id == id {
+				states[i].Capacity--
+				states[i].Subscriptions++
+			}
+		}
+		plan[id] = append(plan[id], req)
+	}
+	// open the planned connections, concurrent connections may take the planned
+	// IDs so the planned sockets are mapped to the opened ones
+	sockets := make(map[SocketId]*Socket, len(states))
+	for i, state := range states {
+		var socket *Socket
+		var err error
+		if i < opened {
+			socket, err = c.socketById(state.Id)
+		} else {
+			socket, err = c.startNewConnection(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sockets[state.Id] = socket
+	}
+	// send the requests socket by socket
+	ids := make([]string, 0, len(reqs))
+	for _, state := range states {
+		planned, ok := plan[state.Id]
+		if !ok {
+			continue
+		}
+		socket := sockets[state.Id]
+		for _, req := range planned {
+			if req.SubID == "" {
+				req.SubID = c.nonce.GetNonce()
+			}
+			id, err := c.subscribeBySocket(ctx, socket, req, nil)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		}
+		c.publish(&SubscribeProgress{SocketId: socket.Id, Subscribed: len(ids), Total: len(reqs)})
+	}
+	return ids, nil
 }
 
 // Submit a request to receive ticker updates
@@ -156,20 +288,133 @@ func (c *Client) SubscribeStatus(ctx context.Context, symbol string, sType bitfi
 
 // Retrieve the Orderbook for the given symbol which is managed locally.
 // This requires ManageOrderbook=True and an active chanel subscribed to the given
-// symbols orderbook
+// symbols orderbook. If the symbol's book is managed at multiple precisions use
+// GetOrderbookBySubscription instead.
 func (c *Client) GetOrderbook(symbol string) (*Orderbook, error) {
-	c.mtx.RLock()
-	defer c.mtx.RUnlock()
-	if val, ok := c.orderbooks[symbol]; ok {
-		// take dereferenced copy of orderbook
+	c.books.lock.RLock()
+	defer c.books.lock.RUnlock()
+	keys := make([]string, 0, len(c.books.books))
+	for key := range c.books.books {
+		keys = append(keys, key)
+	}
+	key, err := symbolBookKey("Orderbook", symbol, keys)
+	if err != nil {
+		return nil, err
+	}
+	return c.books.books[key], nil
+}
+
+// Retrieve the locally managed Orderbook of the book subscription with the given
+// subscription ID.
+func (c *Client) GetOrderbookBySubscription(subID string) (*Orderbook, error) {
+	key, err := c.subscriptionBookKey(subID)
+	if err != nil {
+		return nil, err
+	}
+	c.books.lock.RLock()
+	defer c.books.lock.RUnlock()
+	if val, ok := c.books.books[key]; ok {
 		return val, nil
 	}
-	return nil, fmt.Errorf("Orderbook %s does not exist", symbol)
+	return nil, fmt.Errorf("Orderbook for subscription %s does not exist", subID)
+}
+
+// Retrieve the order-level RawOrderbook for the given symbol which is managed locally.
+// This requires ManageOrderbook=True and an active raw (R0) book subscription
+// for the given symbol
+func (c *Client) GetRawOrderbook(symbol string) (*RawOrderbook, error) {
+	c.books.lock.RLock()
+	defer c.books.lock.RUnlock()
+	keys := make([]string, 0, len(c.books.raw))
+	for key := range c.books.raw {
+		keys = append(keys, key)
+	}
+	key, err := symbolBookKey("RawOrderbook", symbol, keys)
+	if err != nil {
+		return nil, err
+	}
+	return c.books.raw[key], nil
+}
+
+// Retrieve the locally managed RawOrderbook of the raw book subscription with the
+// given subscription ID.
+func (c *Client) GetRawOrderbookBySubscription(subID string) (*RawOrderbook, error) {
+	key, err := c.subscriptionBookKey(subID)
+	if err != nil {
+		return nil, err
+	}
+	c.books.lock.RLock()
+	defer c.books.lock.RUnlock()
+	if val, ok := c.books.raw[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("RawOrderbook for subscription %s does not exist", subID)
+}
+
+// Retrieve the FundingOrderbook for the given funding symbol (i.e. fUSD) which is
+// managed locally. This requires ManageOrderbook=True and an active book subscription
+// for the given funding symbol
+func (c *Client) GetFundingOrderbook(symbol string) (*FundingOrderbook, error) {
+	c.books.lock.RLock()
+	defer c.books.lock.RUnlock()
+	keys := make([]string, 0, len(c.books.funding))
+	for key := range c.books.funding {
+		keys = append(keys, key)
+	}
+	key, err := symbolBookKey("FundingOrderbook", symbol, keys)
+	if err != nil {
+		return nil, err
+	}
+	return c.books.funding[key], nil
+}
+
+// Retrieve the locally managed FundingOrderbook of the funding book subscription
+// with the given subscription ID.
+func (c *Client) GetFundingOrderbookBySubscription(subID string) (*FundingOrderbook, error) {
+	key, err := c.subscriptionBookKey(subID)
+	if err != nil {
+		return nil, err
+	}
+	c.books.lock.RLock()
+	defer c.books.lock.RUnlock()
+	if val, ok := c.books.funding[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("FundingOrderbook for subscription %s does not exist", subID)
+}
+
+// symbolBookKey finds the key of the only managed book of the given symbol
+func symbolBookKey(kind, symbol string, keys []string) (string, error) {
+	found := ""
+	for _, key := range keys {
+		if !strings.HasPrefix(key, symbol+":") {
+			continue
+		}
+		if found != "" {
+			return "", fmt.Errorf("%s %s is managed for multiple subscriptions, use Get%sBySubscription", kind, symbol, kind)
+		}
+		found = key
+	}
+	if found == "" {
+		return "", fmt.Errorf("%s %s does not exist", kind, symbol)
+	}
+	return found, nil
+}
+
+func (c *Client) subscriptionBookKey(subID string) (string, error) {
+	sub, err := c.subscriptions.lookupBySubscriptionID(subID)
+	if err != nil {
+		return "", err
+	}
+	if sub.Request.Channel != ChanBook {
+		return "", fmt.Errorf("subscription %s is not a book subscription", subID)
+	}
+	return bookKey(sub.Request), nil
 }
 
 // Submit a request to create a new order
 func (c *Client) SubmitOrder(ctx context.Context, order *bitfinex.OrderNewRequest) error {
-	socket, err := c.GetAuthenticatedSocket()
+	socket, err := c.getTradingSocket()
 	if err != nil {
 		return err
 	}
@@ -178,7 +423,7 @@ func (c *Client) SubmitOrder(ctx context.Context, order *bitfinex.OrderNewReques
 
 // Submit and update request to change an existing orders values
 func (c *Client) SubmitUpdateOrder(ctx context.Context, orderUpdate *bitfinex.OrderUpdateRequest) error {
-	socket, err := c.GetAuthenticatedSocket()
+	socket, err := c.getTradingSocket()
 	if err != nil {
 		return err
 	}
@@ -187,13 +432,44 @@ func (c *Client) SubmitUpdateOrder(ctx context.Context, orderUpdate *bitfinex.Or
 
 // Submit a cancel request for an existing order
 func (c *Client) SubmitCancel(ctx context.Context, cancel *bitfinex.OrderCancelRequest) error {
-	socket, err := c.GetAuthenticatedSocket()
+	socket, err := c.getTradingSocket()
+	if err != nil {
+		return err
+	}
+	return socket.Asynchronous.Send(ctx, cancel)
+}
+
+// Submit multiple order operations (new orders, updates, cancels and multi
+// cancels) in a single message
+func (c *Client) SubmitOrderMultiOp(ctx context.Context, multiOp *bitfinex.OrderMultiOpRequest) error {
+	socket, err := c.getTradingSocket()
+	if err != nil {
+		return err
+	}
+	return socket.Asynchronous.Send(ctx, multiOp)
+}
+
+// Submit a cancel request for multiple orders by ID, GID, CID or all orders
+func (c *Client) SubmitCancelMulti(ctx context.Context, cancel *bitfinex.OrderMultiCancelRequest) error {
+	socket, err := c.getTradingSocket()
 	if err != nil {
 		return err
 	}
 	return socket.Asynchronous.Send(ctx, cancel)
 }
 
+// Reauthenticate replaces the filters of the authenticated channel on the live
+// connection. The channel is unauthenticated and authenticated again with the
+// given filters, which are kept for reconnects. No filters receive all messages.
+func (c *Client) Reauthenticate(ctx context.Context, filters ...string) error {
+	socket, err := c.GetAuthenticatedSocket()
+	if err != nil {
+		return err
+	}
+	c.setAuthFilters(filters)
+	return socket.Asynchronous.Send(ctx, unauthMsg{Event: "unauth"})
+}
+
 // Get a subscription request using a subscription ID
 func (c *Client) LookupSubscription(subID string) (*SubscriptionRequest, error) {
 	s, err := c.subscriptions.lookupBySubscriptionID(subID)
@@ -205,7 +481,7 @@ func (c *Client) LookupSubscription(subID string) (*SubscriptionRequest, error)
 
 // Submit a new funding offer request
 func (c *Client) SubmitFundingOffer(ctx context.Context, fundingOffer *bitfinex.FundingOfferRequest) error {
-	socket, err := c.GetAuthenticatedSocket()
+	socket, err := c.getTradingSocket()
 	if err != nil {
 		return err
 	}
@@ -214,7 +490,7 @@ func (c *Client) SubmitFundingOffer(ctx context.Context, fundingOffer *bitfinex.
 
 // Submit a request to cancel and existing funding offer
 func (c *Client) SubmitFundingCancel(ctx context.Context, fundingOffer *bitfinex.FundingOfferCancelRequest) error {
-	socket, err := c.GetAuthenticatedSocket()
+	socket, err := c.getTradingSocket()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffStrategy provides the delay to wait before a reconnect attempt.
+// Attempts are counted from 1.
+type BackoffStrategy interface {
+	Delay(attempt int) time.Duration
+}
+
+// ConstantBackoff waits the same interval before every reconnect attempt.
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+// Delay returns the constant interval.
+func (b *ConstantBackoff) Delay(attempt int) time.Duration {
+	return b.Interval
+}
+
+// ExponentialBackoff multiplies the delay with every reconnect attempt, up to
+// a maximum. Jitter randomizes each delay by the given fraction (0.2 = ±20%)
+// so that many clients do not reconnect in lockstep.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// NewExponentialBackoff creates a jittered exponential backoff which doubles
+// the delay from initial up to max.
+func NewExponentialBackoff(initial, max time.Duration) *ExponentialBackoff {
+	return &ExponentialBackoff{
+		Initial:    initial,
+		Max:        max,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+}
+
+// Delay returns the capped and jittered delay for the given attempt.
+func (b *ExponentialBackoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// managedBooks holds the locally managed books by their bookKey. It is shared by
+// the client and the book factory, which updates the books on the read routine.
+type managedBooks struct {
+	lock      sync.RWMutex
+	books     map[string]*Orderbook
+	raw       map[string]*RawOrderbook
+	funding   map[string]*FundingOrderbook
+	reseeding map[string][]*bitfinex.BookUpdate // updates held back until the reseed snapshot is applied
+}
+
+func newManagedBooks() *managedBooks {
+	return &managedBooks{
+		books:     make(map[string]*Orderbook),
+		raw:       make(map[string]*RawOrderbook),
+		funding:   make(map[string]*FundingOrderbook),
+		reseeding: make(map[string][]*bitfinex.BookUpdate),
+	}
+}
+
+// lookup returns the managed book of the subscription, nil if there is none
+func (b *managedBooks) lookup(req *SubscriptionRequest) managedBook {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	key := bookKey(req)
+	if bitfinex.IsFundingSymbol(req.Symbol) {
+		if ob, ok := b.funding[key]; ok {
+			return ob
+		}
+	} else if bitfinex.IsRawBook(req.Precision) {
+		if ob, ok := b.raw[key]; ok {
+			return ob
+		}
+	} else if ob, ok := b.books[key]; ok {
+		return ob
+	}
+	return nil
+}
+
+// remove drops the managed book of the subscription
+func (b *managedBooks) remove(req *SubscriptionRequest) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	key := bookKey(req)
+	delete(b.reseeding, key)
+	if bitfinex.IsFundingSymbol(req.Symbol) {
+		delete(b.funding, key)
+	} else if bitfinex.IsRawBook(req.Precision) {
+		delete(b.raw, key)
+	} else {
+		delete(b.books, key)
+	}
+}
+
+// startReseed holds back the updates of the book until finishReseed, false if
+// the book is already being reseeded
+func (b *managedBooks) startReseed(key string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.reseeding[key]; ok {
+		return false
+	}
+	b.reseeding[key] = make([]*bitfinex.BookUpdate, 0)
+	return true
+}
+
+// isReseeding returns true while the updates of the book are held back
+func (b *managedBooks) isReseeding(key string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	_, ok := b.reseeding[key]
+	return ok
+}
+
+// holdBack buffers the update if the book is being reseeded, the caller must
+// hold the lock
+func (b *managedBooks) holdBack(key string, update *bitfinex.BookUpdate) bool {
+	pending, ok := b.reseeding[key]
+	if ok {
+		b.reseeding[key] = append(pending, update)
+	}
+	return ok
+}
+
+// finishReseed applies the snapshot and replays the updates received since the
+// reseed started. Book updates carry the absolute state of a level or order, so
+// replaying updates which are already part of the snapshot is harmless. Returns
+// false if the reseed was cancelled or superseded by a new websocket snapshot.
+func (b *managedBooks) finishReseed(key string, setWithSnapshot func(*bitfinex.BookUpdateSnapshot), updateWith func(*bitfinex.BookUpdate), snapshot *bitfinex.BookUpdateSnapshot) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	pending, ok := b.reseeding[key]
+	if !ok {
+		return false
+	}
+	delete(b.reseeding, key)
+	setWithSnapshot(snapshot)
+	for _, update := range pending {
+		updateWith(update)
+	}
+	return true
+}
+
+// cancelReseed drops the held back updates of a failed reseed
+func (b *managedBooks) cancelReseed(key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.reseeding, key)
+}
+
+// releaseBook drops the managed book of a removed book subscription, unless the
+// book is still subscribed, i.e. by a resubscription which keeps the book
+func (c *Client) releaseBook(sub *subscription) {
+	if sub == nil || sub.Request.Channel != ChanBook {
+		return
+	}
+	if c.subscriptions.bookSubscribed(bookKey(sub.Request)) {
+		return
+	}
+	c.books.remove(sub.Request)
+}
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyCalc is returned when a calc message is requested without calculations
+var ErrEmptyCalc = errors.New("calc requires at least one calculation request")
+
+// CalcRequest asks the platform to recalculate a balance. The results are
+// delivered as margin info (miu), position (pu), wallet (wu) and funding info
+// (fiu) updates on the authenticated channel.
+type CalcRequest string
+
+// CalcMarginBase requests the base margin info (MarginInfoBase).
+func CalcMarginBase() CalcRequest {
+	return "margin_base"
+}
+
+// CalcMarginSymbol requests the margin info of a symbol (MarginInfoUpdate), i.e. tBTCUSD.
+func CalcMarginSymbol(symbol string) CalcRequest {
+	return CalcRequest("margin_sym_" + symbol)
+}
+
+// CalcPosition requests the position of a symbol (PositionUpdate), i.e. tBTCUSD.
+func CalcPosition(symbol string) CalcRequest {
+	return CalcRequest("position_" + symbol)
+}
+
+// CalcWallet requests the balance of a wallet (WalletUpdate). The wallet type is
+// one of exchange, margin or funding, the currency i.e. BTC.
+func CalcWallet(walletType, currency string) CalcRequest {
+	return CalcRequest("wallet_" + walletType + "_" + currency)
+}
+
+// CalcFundingSymbol requests the funding info of a funding symbol (FundingInfo), i.e. fUSD.
+func CalcFundingSymbol(symbol string) CalcRequest {
+	return CalcRequest("funding_sym_" + symbol)
+}
+
+type calcMsg []CalcRequest
+
+// MarshalJSON converts the calculations into the calc input message
+func (m calcMsg) MarshalJSON() ([]byte, error) {
+	requests := make([][]string, 0, len(m))
+	for _, req := range m {
+		requests = append(requests, []string{string(req)})
+	}
+	aux, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("[0, \"calc\", null, %s]", string(aux))), nil
+}
+
+// Submit a request to recalculate the given balances. The results are published
+// as updates on the authenticated channel.
+func (c *Client) RequestCalc(ctx context.Context, requests ...CalcRequest) error {
+	if len(requests) == 0 {
+		return ErrEmptyCalc
+	}
+	socket, err := c.getTradingSocket()
+	if err != nil {
+		return err
+	}
+	return socket.Asynchronous.Send(ctx, calcMsg(requests))
+}
@@ -1,16 +1,17 @@
 package websocket
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/bitfinexcom/bitfinex-api-go/pkg/convert"
 	"github.com/bitfinexcom/bitfinex-api-go/v2"
 )
 
 func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
-	if c.terminal {
+	received := time.Now()
+	if c.isTerminal() {
 		return fmt.Errorf("received a message after close")
 	}
 
@@ -28,6 +29,11 @@ func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
 	}
 
 	chanID := int64(chID)
+	// the sequence spans all channels of the socket, track it even for messages
+	// of channels which are no longer subscribed, i.e. after an unsubscribe
+	if c.hasFlag(bitfinex.Seq_all) {
+		c.checkSequence(socketId, raw, chanID == 0)
+	}
 	sub, err := c.subscriptions.lookupBySocketChannelID(chanID, socketId)
 	if err != nil {
 		// no subscribed channel for message
@@ -35,6 +41,10 @@ func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
 	}
 	c.subscriptions.heartbeat(chanID)
 	if sub.Public {
+		var ts bitfinex.UpdateTimestamp
+		if c.hasFlag(bitfinex.Timestamp) {
+			ts = updateTimestamp(raw, received)
+		}
 		switch data := raw[1].(type) {
 		case string:
 			switch data {
@@ -49,10 +59,10 @@ func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
 				}
 			default:
 				body := raw[2].([]interface{})
-				return c.handlePublicChannel(sub, sub.Request.Channel, data, body, msg)
+				return c.handlePublicChannel(sub, sub.Request.Channel, data, body, msg, ts)
 			}
 		case []interface{}:
-			return c.handlePublicChannel(sub, sub.Request.Channel, "", data, msg)
+			return c.handlePublicChannel(sub, sub.Request.Channel, "", data, msg, ts)
 		}
 	} else {
 		return c.handlePrivateChannel(raw)
@@ -60,71 +70,81 @@ func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
 	return nil
 }
 
+// updateTimestamp reads the server timestamp which the TIMESTAMP flag appends as
+// the last element of a public channel message:
+//
+//	[CHAN_ID, (TYPE,) DATA, (SEQ,) TIMESTAMP]
+func updateTimestamp(raw []interface{}, received time.Time) bitfinex.UpdateTimestamp {
+	dataIdx := 1
+	if _, ok := raw[1].(string); ok {
+		dataIdx = 2
+	}
+	if len(raw) <= dataIdx+1 {
+		return bitfinex.UpdateTimestamp{}
+	}
+	mts, ok := raw[len(raw)-1].(float64)
+	if !ok {
+		return bitfinex.UpdateTimestamp{}
+	}
+	return bitfinex.UpdateTimestamp{ServerMTS: int64(mts), ReceivedAt: received}
+}
+
 func (c *Client) handleChecksumChannel(sub *subscription, checksum int) error {
 	symbol := sub.Request.Symbol
 	// force to signed integer
 	bChecksum := uint32(checksum)
-	var orderbook *Orderbook
-	c.mtx.Lock()
-	if ob, ok := c.orderbooks[symbol]; ok {
-		orderbook = ob
+	// verify the book of this subscription, other books of the symbol may
+	// be managed at different precisions
+	orderbook := c.books.lookup(sub.Request)
+	if orderbook != nil && c.books.isReseeding(bookKey(sub.Request)) {
+		// the checksum covers updates which are held back until the reseed snapshot is applied
+		return nil
 	}
-	c.mtx.Unlock()
 	if orderbook != nil {
 		oChecksum := orderbook.Checksum()
+		if ob, ok := orderbook.(*Orderbook); ok {
+			ob.notifyChecksum(bChecksum, oChecksum)
+		}
 		// compare bitfinex checksum with local checksum
 		if bChecksum == oChecksum {
 			c.log.Debugf("Orderbook '%s' checksum verification successful.", symbol)
 		} else {
-			c.log.Warningf("Orderbook '%s' checksum is invalid got %d bot got %d. Data Out of sync, reconnecting.",
-				symbol, bChecksum, oChecksum)
-			err := c.sendUnsubscribeMessage(context.Background(), sub)
-			if err != nil {
-				return err
-			}
-			newSub := &SubscriptionRequest{
-				SubID:   c.nonce.GetNonce(), // generate new subID
-				Event:   sub.Request.Event,
-				Channel: sub.Request.Channel,
-				Symbol:  sub.Request.Symbol,
-			}
-			_, err_sub := c.Subscribe(context.Background(), newSub)
-			if err_sub != nil {
-				c.log.Warningf("could not resubscribe: %s", err_sub.Error())
-				return err_sub
-			}
+			c.log.Warningf("Orderbook '%s' checksum is invalid got %d bot got %d. Data Out of sync, applying %s policy.",
+				symbol, bChecksum, oChecksum, c.parameters.ChecksumPolicy)
+			return c.handleChecksumMismatch(sub, orderbook, bChecksum, oChecksum)
 		}
 	}
 	return nil
 }
 
-func (c *Client) handlePublicChannel(sub *subscription, channel, objType string, data []interface{}, raw_msg []byte) error {
+func (c *Client) handlePublicChannel(sub *subscription, channel, objType string, data []interface{}, raw_msg []byte, ts bitfinex.UpdateTimestamp) error {
 	// unauthenticated data slice
 	// public data is returned as raw interface arrays, use a factory to convert to raw type & publish
 	if factory, ok := c.factories[channel]; ok {
 		// convert to type array of interfaces
 		if len(data) > 0 {
 			if _, ok := data[0].([]interface{}); ok {
+				if sub.snapshotReceived && sub.Request.Channel == ChanBook && c.hasFlag(bitfinex.Bulk_updates) {
+					return c.handleBulkUpdates(sub, factory, data, raw_msg, ts)
+				}
+				sub.snapshotReceived = true
 				interfaceArray := convert.ToInterfaceArray(data)
 				// snapshot item
-				c.mtx.Lock()
-				// lock mutex since its mutates client struct
-				msg, err := factory.BuildSnapshot(sub, interfaceArray, raw_msg)
-				c.mtx.Unlock()
+				msg, err := factory.BuildSnapshot(sub, interfaceArray, raw_msg, ts)
 				if err != nil {
 					return err
 				}
 				if msg != nil {
-					c.listener <- msg
+					c.publishSubscriptionData(sub, msg)
 				}
 			} else {
 				// single item
-				msg, err := factory.Build(sub, objType, data, raw_msg)
+				msg, err := factory.Build(sub, objType, data, raw_msg, ts)
 				if err != nil {
 					return err
 				}
 				if msg != nil {
-					c.listener <- msg
+					c.publishSubscriptionData(sub, msg)
 				}
 			}
 		}
@@ -135,6 +155,34 @@ func (c *Client) handlePublicChannel(sub *subscription, channel, objType string,
 	return nil
 }
 
+// handleBulkUpdates applies the book updates of a bulk message (BULK_UPDATES flag)
+// one by one, they are sent in the same format as a snapshot
+func (c *Client) handleBulkUpdates(sub *subscription, factory messageFactory, data []interface{}, raw_msg []byte, ts bitfinex.UpdateTimestamp) error {
+	raw_json_number, err := ConvertBytesToJsonNumberArray(raw_msg)
+	if err != nil {
+		return err
+	}
+	numbers, ok := raw_json_number[1].([]interface{})
+	if !ok || len(numbers) != len(data) {
+		return fmt.Errorf("could not parse bulk update: %s", raw_msg)
+	}
+	for i, update := range data {
+		// rebuild a single update message, json numbers keep their exact value
+		update_bytes, err := json.Marshal([]interface{}{raw_json_number[0], numbers[i]})
+		if err != nil {
+			return err
+		}
+		msg, err := factory.Build(sub, "", update.([]interface{}), update_bytes, ts)
+		if err != nil {
+			return err
+		}
+		if msg != nil {
+			c.publishSubscriptionData(sub, msg)
+		}
+	}
+	return nil
+}
+
 func (c *Client) handlePrivateChannel(raw []interface{}) error {
 	// authenticated data slice, or a heartbeat
 	if val, ok := raw[1].(string); ok && val == "hb" {
@@ -153,9 +201,21 @@ func (c *Client) handlePrivateChannel(raw []interface{}) error {
 				if err != nil {
 					return err
 				}
+				if c.accountState != nil {
+					// empty snapshots are not published but clear the state
+					if len(arr) == 0 {
+						c.accountState.clear(raw[1].(string))
+					} else if obj != nil {
+						c.accountState.update(obj)
+					}
+				}
+				// match notifications with requests awaiting a response
+				if n, ok := obj.(*bitfinex.Notification); ok {
+					c.pending.resolve(n)
+				}
 				// private data is returned as strongly typed data, publish directly
 				if obj != nil {
-					c.listener <- obj
+					c.publish(obj)
 				}
 			}
 		}
@@ -172,6 +232,10 @@ type unsubscribeMsg struct {
 	ChanID int64  `json:"chanId"`
 }
 
+type unauthMsg struct {
+	Event string `json:"event"`
+}
+
 // public msg: [ChanID, [Data]]
 // hb (both): [ChanID, "hb"]
 // private update msg: [ChanID, "type", [Data]]
@@ -0,0 +1,209 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// ChecksumPolicy defines how a managed book is resynchronized after its checksum
+// did not match the checksum sent by the API.
+type ChecksumPolicy int
+
+const (
+	// ChecksumResubscribe unsubscribes and resubscribes the book with identical
+	// parameters, the new snapshot replaces the managed book.
+	ChecksumResubscribe ChecksumPolicy = 0
+	// ChecksumReseed replaces the managed book with a snapshot fetched from the
+	// BookSnapshotProvider and keeps the subscription streaming. The snapshot is
+	// fetched in the background, updates of the book are held back until it is
+	// applied. Books which can not be reseeded (funding books, missing provider
+	// or a failed request) are resubscribed instead.
+	ChecksumReseed ChecksumPolicy = 1
+	// ChecksumNotify only publishes a ChecksumMismatch event, the user decides
+	// how to resynchronize.
+	ChecksumNotify ChecksumPolicy = 2
+)
+
+func (p ChecksumPolicy) String() string {
+	switch p {
+	case ChecksumResubscribe:
+		return "resubscribe"
+	case ChecksumReseed:
+		return "reseed"
+	case ChecksumNotify:
+		return "notify"
+	}
+	return "unknown"
+}
+
+// BookSnapshotProvider fetches book snapshots to reseed managed books, it is
+// satisfied by the rest client's BookService.
+type BookSnapshotProvider interface {
+	All(symbol string, precision bitfinex.BookPrecision, priceLevels int) (*bitfinex.BookUpdateSnapshot, error)
+}
+
+// ChecksumMismatch is published whenever the checksum of a managed book does not
+// match the checksum sent by the API.
+type ChecksumMismatch struct {
+	SubID      string
+	Symbol     string
+	Precision  string
+	Expected   uint32         // checksum sent by the API
+	Calculated uint32         // checksum of the local book
+	Mismatches uint64         // mismatches of this book so far
+	Policy     ChecksumPolicy // resynchronization applied to the book
+}
+
+// managedBook is implemented by all locally managed books
+type managedBook interface {
+	Checksum() uint32
+	ChecksumMismatches() uint64
+	recordChecksumMismatch() uint64
+}
+
+// mismatchCounter counts the checksum mismatches of a book. It must be the first
+// field of the book to keep the counter 64-bit aligned for atomic access.
+type mismatchCounter struct {
+	mismatches uint64
+}
+
+// ChecksumMismatches returns how often the checksum of the book did not match
+// the checksum sent by the API.
+func (m *mismatchCounter) ChecksumMismatches() uint64 {
+	return atomic.LoadUint64(&m.mismatches)
+}
+
+func (m *mismatchCounter) recordChecksumMismatch() uint64 {
+	return atomic.AddUint64(&m.mismatches, 1)
+}
+
+// default book length of the API, used when the subscription did not set one
+const defaultBookLength = 25
+
+func (c *Client) handleChecksumMismatch(sub *subscription, book managedBook, expected, calculated uint32) error {
+	mismatches := book.recordChecksumMismatch()
+	c.publish(&ChecksumMismatch{
+		SubID:      sub.Request.SubID,
+		Symbol:     sub.Request.Symbol,
+		Precision:  sub.Request.Precision,
+		Expected:   expected,
+		Calculated: calculated,
+		Mismatches: mismatches,
+		Policy:     c.parameters.ChecksumPolicy,
+	})
+	switch c.parameters.ChecksumPolicy {
+	case ChecksumNotify:
+		return nil
+	case ChecksumReseed:
+		err := c.reseedBook(sub, book)
+		if err == nil {
+			return nil
+		}
+		c.log.Warningf("could not reseed orderbook '%s', resubscribing: %s", sub.Request.Symbol, err.Error())
+	}
+	return c.resubscribe(sub)
+}
+
+// reseedBook fetches a snapshot from the BookSnapshotProvider without blocking the
+// socket's read routine. Updates of the book are held back until the snapshot is
+// applied, the book is resubscribed if the snapshot can not be fetched.
+func (c *Client) reseedBook(sub *subscription, book managedBook) error {
+	if c.parameters.BookSnapshotProvider == nil {
+		return fmt.Errorf("no BookSnapshotProvider set")
+	}
+	length := defaultBookLength
+	if sub.Request.Len != "" {
+		l, err := strconv.Atoi(sub.Request.Len)
+		if err != nil {
+			return err
+		}
+		length = l
+	}
+	var setWithSnapshot func(*bitfinex.BookUpdateSnapshot)
+	var updateWith func(*bitfinex.BookUpdate)
+	// observer events are collected under the books lock and delivered after
+	events := make([]*OrderbookEvent, 0)
+	notify := func() {}
+	switch ob := book.(type) {
+	case *Orderbook:
+		setWithSnapshot = func(s *bitfinex.BookUpdateSnapshot) { events = append(events, ob.setWithSnapshot(s)) }
+		updateWith = func(u *bitfinex.BookUpdate) { events = append(events, ob.updateWith(u)) }
+		notify = func() {
+			for _, ev := range events {
+				ob.observers.notify(ev)
+			}
+		}
+	case *RawOrderbook:
+		setWithSnapshot, updateWith = ob.SetWithSnapshot, ob.UpdateWith
+	default:
+		return fmt.Errorf("book of %s can not be reseeded", sub.Request.Symbol)
+	}
+	key := bookKey(sub.Request)
+	if !c.books.startReseed(key) {
+		// the snapshot requested by an earlier mismatch is still pending
+		return nil
+	}
+	go func() {
+		snapshot, err := c.parameters.BookSnapshotProvider.All(sub.Request.Symbol, bitfinex.BookPrecision(sub.Request.Precision), length)
+		if err != nil {
+			c.books.cancelReseed(key)
+			c.log.Warningf("could not reseed orderbook '%s', resubscribing: %s", sub.Request.Symbol, err.Error())
+			if err := c.resubscribe(sub); err != nil {
+				c.log.Errorf("could not resubscribe %s: %s", sub.Request.String(), err.Error())
+			}
+			return
+		}
+		if c.books.finishReseed(key, setWithSnapshot, updateWith, snapshot) {
+			c.log.Infof("Orderbook '%s' reseeded from snapshot", sub.Request.Symbol)
+			notify()
+		}
+	}()
+	return nil
+}
+
+// resubscribe resubscribes with identical parameters on the same socket, the new
+// snapshot of a book replaces the managed book
+func (c *Client) resubscribe(sub *subscription) error {
+	err := c.sendUnsubscribeMessage(context.Background(), sub)
+	if err != nil {
+		return err
+	}
+	socket, err := c.socketById(sub.SocketId)
+	if err != nil {
+		return err
+	}
+	newSub := *sub.Request
+	newSub.SubID = c.nonce.GetNonce() // generate new subID
+	// stay on the socket, the subscription may have been pinned to it
+	_, err_sub := c.subscribeBySocket(context.Background(), socket, &newSub, sub.stream)
+	if err_sub != nil {
+		c.log.Warningf("could not resubscribe: %s", err_sub.Error())
+		return err_sub
+	}
+	return nil
+}
+
+// resubscribePublic resubscribes all active public channels of the socket and
+// returns the number of resubscribed channels
+func (c *Client) resubscribePublic(socketId SocketId) int {
+	subs, err := c.subscriptions.lookupBySocketId(socketId)
+	if err != nil {
+		return 0
+	}
+	resubscribed := 0
+	for _, sub := range *subs {
+		if !sub.Public || sub.Pending() {
+			continue
+		}
+		if err := c.resubscribe(sub); err != nil {
+			c.log.Errorf("could not resubscribe %s: %s", sub.Request.String(), err.Error())
+			continue
+		}
+		resubscribed++
+	}
+	return resubscribed
+}
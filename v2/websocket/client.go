@@ -72,11 +72,21 @@ type Asynchronous interface {
 
 type SocketId int
 type Socket struct {
+	// unix nanoseconds of the last received message, first for 64-bit alignment
+	lastMessage        int64
+
 	Id                 SocketId
 	Asynchronous
 	IsConnected        bool
 	ResetSubscriptions []*subscription
 	IsAuthenticated    bool
+
+	// round trips of the application level pings
+	latency            *latencyTracker
+
+	// last sequence numbers received with the SEQ_ALL flag
+	pubSeq             int64
+	authSeq            int64
 }
 
 // AsynchronousFactory provides an interface to re-create asynchronous transports during reconnect events.
@@ -107,9 +117,14 @@ type Client struct {
 	asyncFactory       AsynchronousFactory // for re-creating transport during reconnects
 
 	timeout            int64 // read timeout
+	pingCid            int64 // cid of the last application level ping
 	apiKey             string
 	apiSecret          string
 	cancelOnDisconnect bool
+	authFilters        []string
+	flags              int // enabled configuration flags
+	maintenance        bool // platform is in maintenance mode
+	queuedConnections  int32 // connections waiting for the ConnectionLimiter
 	Authentication     AuthState
 	sockets            map[SocketId]*Socket
 	nonce              utils.NonceGenerator
@@ -119,17 +134,23 @@ type Client struct {
 
 	// connection & operational behavior
 	parameters         *Parameters
+	clock              *bitfinex.ServerClock
 
 	// subscription manager
 	subscriptions      *subscriptions
 	factories          map[string]messageFactory
-	orderbooks         map[string]*Orderbook
+	books              *managedBooks
+	accountState       *AccountState
+
+	// requests awaiting a notification
+	pending            *pendingRequests
+	pendingSubs        *pendingSubscriptions
 
 	// close signal sent to user on shutdown
 	shutdown           chan bool
 
 	// downstream listener channel to deliver API objects
-	listener           chan interface{}
+	listener           *messageQueue
 
 	// race management
 	mtx                *sync.RWMutex
@@ -149,6 +170,26 @@ func (c *Client) CancelOnDisconnect(cxl bool) *Client {
 	return c
 }
 
+// AuthFilter restricts the authenticated channel to the messages of the given
+// filters, i.e. FilterFunding. The filters are applied whenever the client
+// authenticates, including after reconnects.
+func (c *Client) AuthFilter(filters ...string) *Client {
+	c.setAuthFilters(filters)
+	return c
+}
+
+func (c *Client) setAuthFilters(filters []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.authFilters = filters
+}
+
+func (c *Client) getAuthFilters() []string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.authFilters
+}
+
 func (c *Client) sign(msg string) (string, error) {
 	sig := hmac.New(sha512.New384, []byte(c.apiSecret))
 	_, err := sig.Write([]byte(msg))
@@ -195,19 +236,32 @@ func NewWithParamsAsyncFactory(params *Parameters, async AsynchronousFactory) *C
 // NewWithParamsAsyncFactoryNonce creates a new client with a given set of parameters, asynchronous transport factory, and nonce generator interfaces.
 func NewWithParamsAsyncFactoryNonce(params *Parameters, async AsynchronousFactory, nonce utils.NonceGenerator) *Client {
 	c := &Client{
-		asyncFactory:   async,
-		Authentication: NoAuthentication,
-		factories:      make(map[string]messageFactory),
-		subscriptions:  newSubscriptions(params.HeartbeatTimeout, params.Logger),
-		orderbooks:     make(map[string]*Orderbook),
-		nonce:          nonce,
-		parameters:     params,
-		listener:       make(chan interface{}),
-		terminal:       false,
-		shutdown:       nil,
-		sockets:        make(map[SocketId]*Socket),
-		mtx:            &sync.RWMutex{},
-		log:            params.Logger,
+		asyncFactory:      async,
+		Authentication:    NoAuthentication,
+		factories:         make(map[string]messageFactory),
+		subscriptions:     newSubscriptions(params.HeartbeatTimeout, params.Logger),
+		books:             newManagedBooks(),
+		pending:           newPendingRequests(),
+		pendingSubs:       newPendingSubscriptions(),
+		nonce:             nonce,
+		parameters:        params,
+		listener:          newMessageQueue(params.ListenerBufferSize, params.ListenerPolicy),
+		terminal:          false,
+		shutdown:          nil,
+		sockets:           make(map[SocketId]*Socket),
+		mtx:               &sync.RWMutex{},
+		log:               params.Logger,
+	}
+	if params.ManageAccountState {
+		c.accountState = newAccountState()
+	}
+	c.clock = params.Clock
+	if c.clock == nil {
+		c.clock = bitfinex.NewServerClock()
+	}
+	if params.ManageOrderbook {
+		// managed books are verified with checksums
+		c.flags = bitfinex.Checksum
 	}
 	c.registerPublicFactories()
 	return c
@@ -216,9 +270,12 @@ func NewWithParamsAsyncFactoryNonce(params *Parameters, async AsynchronousFactor
 // Connect to the Bitfinex API, this should only be called once.
 func (c *Client) Connect() error {
 	c.dumpParams()
+	c.mtx.Lock()
 	c.terminal = false
+	c.mtx.Unlock()
 	go c.listenDisconnect()
-	return c.connectSocket(SocketId(len(c.sockets)))
+	_, err := c.startNewConnection(context.Background())
+	return err
 }
 
 
@@ -237,31 +294,45 @@ func (c *Client) IsConnected() bool {
 // Listen for all incoming api websocket messages
 // When a websocket connection is terminated, the publisher channel will close.
 func (c *Client) Listen() <-chan interface{} {
-	return c.listener
+	return c.listener.messages
+}
+
+// DroppedMessages returns the count of messages which were not delivered to
+// the Listen() channel due to the configured ListenerPolicy.
+func (c *Client) DroppedMessages() uint64 {
+	return c.listener.Dropped()
+}
+
+// publish delivers the message to the Listen() channel
+func (c *Client) publish(msg interface{}) {
+	c.listener.push(msg, nil)
 }
 
 // Close the websocket client which will cause for all
 // active sockets to be exited and the Done() function
 // to be called
 func (c *Client) Close() {
+	c.mtx.Lock()
 	c.terminal = true
-	var wg sync.WaitGroup
-	socketCount := len(c.sockets)
-	if socketCount > 0 {
-		for _, socket := range c.sockets {
-			if socket.IsConnected {
-				wg.Add(1)
-				socket.IsConnected = false
-				go func(s *Socket) {
-					c.closeAsyncAndWait(s, c.parameters.ShutdownTimeout)
-					wg.Done()
-				}(socket)
-			}
+	closing := make([]*Socket, 0, len(c.sockets))
+	for _, socket := range c.sockets {
+		if socket.IsConnected {
+			socket.IsConnected = false
+			closing = append(closing, socket)
 		}
-		wg.Wait()
 	}
+	c.mtx.Unlock()
+	var wg sync.WaitGroup
+	for _, socket := range closing {
+		wg.Add(1)
+		go func(s *Socket) {
+			c.closeAsyncAndWait(s, c.parameters.ShutdownTimeout)
+			wg.Done()
+		}(socket)
+	}
+	wg.Wait()
 	c.subscriptions.Close()
-	close(c.listener)
+	c.listener.close()
 }
 
 // Unsubscribe from the existing subscription with the given id
@@ -280,28 +351,28 @@ func (c *Client) listenDisconnect() {
 		case <- c.shutdown:
 			return
 		case hbErr := <- c.subscriptions.ListenDisconnect(): // subscription heartbeat timeout
-			c.log.Warningf("heartbeat disconnect: %s", hbErr.Error.Error())
-			c.mtx.Lock()
-			if socket, ok := c.sockets[hbErr.Subscription.SocketId]; ok {
-				if socket.IsConnected {
-					c.log.Infof("restarting socket (id=%d) connection", socket.Id)
-					socket.IsConnected = false
-					// reconnect to the socket
-					go func() {
-						c.closeAsyncAndWait(socket, c.parameters.ShutdownTimeout)
-						err := c.reconnect(socket, hbErr.Error)
-						if err != nil {
-							c.log.Warningf("socket disconnect: %s", err.Error())
-							return
-						}
-					}()
-				}
-			}
-			c.mtx.Unlock()
+			c.recoverHeartbeat(hbErr)
 		}
 	}
 }
 
+// restartSocket closes the connection of the socket and reconnects it in the
+// background, the caller must hold the client lock
+func (c *Client) restartSocket(socket *Socket, reason error) {
+	c.log.Infof("restarting socket (id=%d) connection", socket.Id)
+	socket.IsConnected = false
+	// reconnect to the socket
+	go func() {
+		c.publishLifecycleEvent(&SocketDisconnected{SocketId: socket.Id, Error: reason})
+		c.closeAsyncAndWait(socket, c.parameters.ShutdownTimeout)
+		err := c.reconnect(socket, reason)
+		if err != nil {
+			c.log.Warningf("socket disconnect: %s", err.Error())
+			return
+		}
+	}()
+}
+
 func extractSymbolResolutionFromKey(subscription string) (symbol string, resolution bitfinex.CandleResolution, err error) {
 	var res, sym string
 	str := strings.Split(subscription, ":")
@@ -320,7 +391,7 @@ func extractSymbolResolutionFromKey(subscription string) (symbol string, resolut
 func (c *Client) registerPublicFactories() {
 	c.registerFactory(ChanTicker, newTickerFactory(c.subscriptions))
 	c.registerFactory(ChanTrades, newTradeFactory(c.subscriptions))
-	c.registerFactory(ChanBook, newBookFactory(c.subscriptions, c.orderbooks, c.parameters.ManageOrderbook))
+	c.registerFactory(ChanBook, newBookFactory(c.subscriptions, c.books, c.parameters.ManageOrderbook))
 	c.registerFactory(ChanCandles, newCandlesFactory(c.subscriptions))
 	c.registerFactory(ChanStatus, newStatsFactory(c.subscriptions))
 }
@@ -338,21 +409,31 @@ func (c *Client) reconnect(socket *Socket, err error) error {
 		return err
 	}
 	c.mtx.RUnlock()
+	backoff := c.reconnectBackoff()
 	reconnectTry := 0
 	for ; reconnectTry < c.parameters.ReconnectAttempts; reconnectTry++ {
-		c.log.Debugf("socket (id=%d) waiting %s until reconnect...", socket.Id, c.parameters.ReconnectInterval)
-		time.Sleep(c.parameters.ReconnectInterval)
+		delay := backoff.Delay(reconnectTry+1)
+		c.publishLifecycleEvent(&Reconnecting{
+			SocketId: socket.Id,
+			Attempt: reconnectTry+1,
+			MaxAttempts: c.parameters.ReconnectAttempts,
+			Delay: delay,
+		})
+		c.log.Debugf("socket (id=%d) waiting %s until reconnect...", socket.Id, delay)
+		time.Sleep(delay)
 		c.log.Infof("socket (id=%d) reconnect attempt %d/%d", socket.Id, reconnectTry+1, c.parameters.ReconnectAttempts)
-		err := c.reconnectSocket(socket)
-		if err == nil {
+		reconnectErr := c.reconnectSocket(socket)
+		if reconnectErr == nil {
 			c.log.Debugf("reconnect OK")
 			return nil
 		}
+		err = reconnectErr
 		c.log.Warningf("socket (id=%d) reconnect failed: %s", socket.Id, err.Error())
 	}
 	if err != nil {
 		c.log.Errorf("socket (id=%d) could not reconnect: %s", socket.Id, err.Error())
 	}
+	c.publishLifecycleEvent(&ReconnectFailed{SocketId: socket.Id, Attempts: reconnectTry, Error: err})
 	return err
 }
 
@@ -362,40 +443,65 @@ func (c *Client) dumpParams() {
 	c.log.Debugf("CapacityPerConnection=%t", c.parameters.CapacityPerConnection)
 	c.log.Debugf("ReconnectInterval=%s", c.parameters.ReconnectInterval)
 	c.log.Debugf("ReconnectAttempts=%d", c.parameters.ReconnectAttempts)
+	c.log.Debugf("ReconnectBackoff=%T", c.reconnectBackoff())
+	c.log.Debugf("ConnectionLimiter=%T", c.parameters.ConnectionLimiter)
+	c.log.Debugf("SocketSelector=%T", c.socketSelector())
 	c.log.Debugf("ShutdownTimeout=%s", c.parameters.ShutdownTimeout)
 	c.log.Debugf("ResubscribeOnReconnect=%t", c.parameters.ResubscribeOnReconnect)
 	c.log.Debugf("HeartbeatTimeout=%s", c.parameters.HeartbeatTimeout)
+	c.log.Debugf("HeartbeatEscalation=%d", c.parameters.HeartbeatEscalation)
+	c.log.Debugf("PingInterval=%s", c.parameters.PingInterval)
+	c.log.Debugf("PongTimeout=%s", c.parameters.PongTimeout)
 	c.log.Debugf("URL=%s", c.parameters.URL)
 	c.log.Debugf("ManageOrderbook=%t", c.parameters.ManageOrderbook)
-}
-
-func (c *Client) connectSocket(socketId SocketId) error {
-	async := c.asyncFactory.Create()
-	// create new socket instance
-	socket := &Socket{
-		Id: socketId,
-		Asynchronous: async,
-		IsConnected: false,
-		ResetSubscriptions: nil,
-		IsAuthenticated: false,
+	c.log.Debugf("ManageAccountState=%t", c.parameters.ManageAccountState)
+	c.log.Debugf("ChecksumPolicy=%s", c.parameters.ChecksumPolicy)
+	c.log.Debugf("BookSnapshotProvider=%T", c.parameters.BookSnapshotProvider)
+	c.log.Debugf("SequenceGapPolicy=%s", c.parameters.SequenceGapPolicy)
+	c.log.Debugf("ListenerBufferSize=%d", c.parameters.ListenerBufferSize)
+	c.log.Debugf("ListenerPolicy=%s", c.parameters.ListenerPolicy)
+}
+
+// connectSocket replaces the connection of an existing socket
+func (c *Client) connectSocket(ctx context.Context, socketId SocketId) error {
+	// respect the connection limit of the platform
+	if err := c.waitConnectionLimit(ctx, socketId); err != nil {
+		return err
 	}
-	oldSocket, _ := c.socketById(socketId)
-	if oldSocket != nil {
+	socket := c.newSocket(socketId)
+	c.mtx.Lock()
+	if oldSocket, ok := c.sockets[socketId]; ok {
 		// socket exists so use its state
 		socket.IsAuthenticated = oldSocket.IsAuthenticated
 		socket.ResetSubscriptions = oldSocket.ResetSubscriptions
 	}
-	c.mtx.Lock()
 	// add socket to managed map
 	c.sockets[socket.Id] = socket
 	c.mtx.Unlock()
+	return c.openSocket(socket)
+}
+
+func (c *Client) newSocket(socketId SocketId) *Socket {
+	return &Socket{
+		Id: socketId,
+		Asynchronous: c.asyncFactory.Create(),
+		IsConnected: false,
+		ResetSubscriptions: nil,
+		IsAuthenticated: false,
+		latency: newLatencyTracker(),
+	}
+}
+
+func (c *Client) openSocket(socket *Socket) error {
 	// connect socket
 	err := socket.Asynchronous.Connect()
 	if err != nil {
 		// unable to establish connection
 		return err
 	}
+	c.mtx.Lock()
 	socket.IsConnected = true
+	c.mtx.Unlock()
 	go c.listenUpstream(socket)
 	return nil
 }
@@ -407,7 +513,7 @@ func (c *Client) reconnectSocket(socket *Socket) error {
 		socket.ResetSubscriptions = c.subscriptions.ResetSocketSubscriptions(socket.Id)
 	}
 	// establish a new connection
-	err := c.connectSocket(socket.Id)
+	err := c.connectSocket(context.Background(), socket.Id)
 	if err != nil {
 		return err
 	}
@@ -416,10 +522,18 @@ func (c *Client) reconnectSocket(socket *Socket) error {
 
 // start this goroutine before connecting, but this should die during a connection failure
 func (c *Client) listenUpstream(socket *Socket) {
+	socket.touch(time.Now())
+	// a slow consumer must not hold up reading the socket
+	c.offerLifecycleEvent(&SocketConnected{SocketId: socket.Id})
+	pings, stopPings := c.pingTicker()
+	defer stopPings()
 	for {
 		select {
+		case <- pings:
+			c.ping(socket)
 		case err := <- socket.Asynchronous.Done():
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
+				c.publishLifecycleEvent(&SocketDisconnected{SocketId: socket.Id, Error: err})
 				err := c.reconnect(socket, err)
 				if err != nil {
 					c.log.Errorf("Unable to reconnect socket (id=%d) after err: %s", socket.Id, err.Error())
@@ -429,6 +543,7 @@ func (c *Client) listenUpstream(socket *Socket) {
 			return
 		case msg := <- socket.Asynchronous.Listen():
 			if msg != nil {
+				socket.touch(time.Now())
 				err := c.handleMessage(socket.Id, msg)
 				if err != nil {
 					c.log.Warningf("upstream listen error: %s", err.Error())
@@ -486,15 +601,17 @@ func (c *Client) checkResubscription(socketId SocketId) {
 	if err != nil {
 		panic(err)
 	}
-	if c.parameters.ManageOrderbook {
+	// apply the enabled flags to the new or reconnected socket
+	if flags := c.Flags(); flags != 0 {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
-		_, err_flag := c.EnableFlag(ctx, bitfinex.Checksum)
+		err_flag := socket.Asynchronous.Send(ctx, &FlagRequest{Event: "conf", Flags: flags})
 		if err_flag != nil {
-			c.log.Errorf("could not enable checksum flag %s ", err_flag)
+			c.log.Errorf("could not enable flags %d: %s", flags, err_flag)
 		}
 	}
 	if c.parameters.ResubscribeOnReconnect && socket.ResetSubscriptions != nil {
+		resubscribed := 0
 		for _, sub := range socket.ResetSubscriptions {
 			if sub.Request.Event == "auth" {
 				continue
@@ -503,22 +620,28 @@ func (c *Client) checkResubscription(socketId SocketId) {
 			defer cancel()
 			sub.Request.SubID = c.nonce.GetNonce() // new nonce
 			c.log.Infof("socket (id=%d) resubscribing to %s with nonce %s", socket.Id, sub.Request.String(), sub.Request.SubID)
-			_, err := c.subscribeBySocket(ctx, socket, sub.Request)
+			_, err := c.subscribeBySocket(ctx, socket, sub.Request, sub.stream)
 			if err != nil {
 				c.log.Errorf("could not resubscribe: %s", err.Error())
+				continue
 			}
+			resubscribed++
 		}
 		socket.ResetSubscriptions = nil
+		c.publishLifecycleEvent(&Resubscribed{SocketId: socket.Id, Subscriptions: resubscribed})
 	}
 }
 
 // called when an info event is received
 func (c *Client) handleOpen(socketId SocketId) error {
+	if socket, err := c.socketById(socketId); err == nil {
+		socket.resetSequences()
+	}
 	authSocket, _ := c.GetAuthenticatedSocket()
 	// if we have auth credentials and there is currently no authenticated
 	// sockets (we are only allowed one)
 	if c.hasCredentials() && authSocket == nil {
-		err_auth := c.authenticate(context.Background(), socketId)
+		err_auth := c.authenticate(context.Background(), socketId, c.getAuthFilters()...)
 		if err_auth != nil {
 			return err_auth
 		}
@@ -526,7 +649,7 @@ func (c *Client) handleOpen(socketId SocketId) error {
 	}
 	// if the opening socket (triggered by reconnect) is authenticated then re-authenticate
 	if authSocket != nil && authSocket.Id == socketId {
-		err_auth := c.authenticate(context.Background(), socketId)
+		err_auth := c.authenticate(context.Background(), socketId, c.getAuthFilters()...)
 		if err_auth != nil {
 			return err_auth
 		}
@@ -545,7 +668,11 @@ func (c *Client) handleAuthAck(socketId SocketId, auth *AuthEvent) {
 		if err != nil {
 			panic(err)
 		}
+		c.mtx.Lock()
 		socket.IsAuthenticated = true
+		c.mtx.Unlock()
+		// a new authenticated channel starts a new sequence
+		socket.authSeq = 0
 		err = c.subscriptions.activate(auth.SubID, auth.ChanID)
 		if err != nil {
 			c.log.Errorf("could not activate auth subscription: %s", err.Error())
@@ -556,6 +683,28 @@ func (c *Client) handleAuthAck(socketId SocketId, auth *AuthEvent) {
 	}
 }
 
+// called when an unauth event is received, authenticates again with the
+// current filters
+func (c *Client) handleUnauthAck(socketId SocketId, unauth *UnauthEvent) error {
+	if unauth.Status != "OK" {
+		c.log.Errorf("could not unauthenticate: %s", unauth.Status)
+		return nil
+	}
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	socket.IsAuthenticated = false
+	c.mtx.Unlock()
+	c.Authentication = NoAuthentication
+	_, err = c.subscriptions.removeByChannelID(unauth.ChanID)
+	if err != nil {
+		c.log.Warningf("could not remove auth subscription: %s", err.Error())
+	}
+	return c.authenticate(context.Background(), socketId, c.getAuthFilters()...)
+}
+
 func (c *Client) hasCredentials() bool {
 	return c.apiKey != "" && c.apiSecret != ""
 }
@@ -582,7 +731,7 @@ func (c *Client) authenticate(ctx context.Context, socketId SocketId, filter ...
 	if c.cancelOnDisconnect {
 		s.DMS = DMSCancelOnDisconnect
 	}
-	c.subscriptions.add(socketId, s)
+	c.subscriptions.add(socketId, s, nil)
 	socket, err := c.socketById(socketId)
 	if err != nil {
 		return err
@@ -594,35 +743,6 @@ func (c *Client) authenticate(ctx context.Context, socketId SocketId, filter ...
 	return nil
 }
 
-// get a random socket
-func (c *Client) getSocket() (*Socket, error) {
-	if len(c.sockets) <= 0 {
-		return nil, fmt.Errorf("no socket found")
-	}
-	return c.sockets[0], nil
-}
-
-func (c *Client) getMostAvailableSocket() (*Socket, error) {
-	var retSocket *Socket
-	bestCapacity := 0
-	for _, socket := range c.sockets {
-		capac := c.getAvailableSocketCapacity(socket.Id)
-		if retSocket == nil {
-			retSocket = socket
-			bestCapacity = capac
-			continue
-		}
-		if capac > bestCapacity {
-			retSocket = socket
-			bestCapacity = capac
-		}
-	}
-	if retSocket == nil {
-		return nil, fmt.Errorf("no socket found")
-	}
-	return retSocket, nil
-}
-
 // lookup the socket with the given Id, throw error if not found
 func (c *Client) socketById(socketId SocketId) (*Socket, error) {
 	c.mtx.RLock()
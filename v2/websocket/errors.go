@@ -0,0 +1,42 @@
+package websocket
+
+import (
+	"fmt"
+)
+
+// EventError is the Go error of an error event sent by the API. Errors of the
+// same code match with errors.Is, i.e. errors.Is(err, ErrUnknownPair).
+type EventError struct {
+	Code    int
+	Message string
+	Event   *ErrorEvent // the originating event, nil for the predefined errors
+}
+
+func (e *EventError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Is matches errors by their error code
+func (e *EventError) Is(target error) bool {
+	t, ok := target.(*EventError)
+	return ok && t.Code == e.Code
+}
+
+// errors of the documented error codes
+var (
+	ErrUnknownEvent         = &EventError{Code: ErrorCodeUnknownEvent, Message: "unknown event"}
+	ErrUnknownPair          = &EventError{Code: ErrorCodeUnknownPair, Message: "unknown pair"}
+	ErrUnknownBookPrecision = &EventError{Code: ErrorCodeUnknownBookPrecision, Message: "unknown book precision"}
+	ErrUnknownBookLength    = &EventError{Code: ErrorCodeUnknownBookLength, Message: "unknown book length"}
+	ErrSubscriptionFailed   = &EventError{Code: ErrorCodeSubscriptionFailed, Message: "subscription failed"}
+	ErrAlreadySubscribed    = &EventError{Code: ErrorCodeAlreadySubscribed, Message: "already subscribed"}
+	ErrUnknownChannel       = &EventError{Code: ErrorCodeUnknownChannel, Message: "unknown channel"}
+	ErrChannelLimit         = &EventError{Code: ErrorCodeChannelLimit, Message: "reached limit of open channels"}
+	ErrUnsubscribeFailed    = &EventError{Code: ErrorCodeUnsubscribeFailed, Message: "unsubscription failed"}
+	ErrNotSubscribed        = &EventError{Code: ErrorCodeNotSubscribed, Message: "not subscribed"}
+)
+
+// Err converts the error event into an *EventError
+func (e *ErrorEvent) Err() error {
+	return &EventError{Code: e.Code, Message: e.Message, Event: e}
+}
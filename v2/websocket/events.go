@@ -35,6 +35,12 @@ type AuthEvent struct {
 	Caps    Capabilities `json:"caps"`
 }
 
+type UnauthEvent struct {
+	Event  string `json:"event"`
+	Status string `json:"status"`
+	ChanID int64  `json:"chanId"`
+}
+
 type Capability struct {
 	Read  int `json:"read"`
 	Write int `json:"write"`
@@ -59,6 +65,7 @@ const (
 	ErrorCodeSubscriptionFailed   int = 10300
 	ErrorCodeAlreadySubscribed    int = 10301
 	ErrorCodeUnknownChannel       int = 10302
+	ErrorCodeChannelLimit         int = 10305
 	ErrorCodeUnsubscribeFailed    int = 10400
 	ErrorCodeNotSubscribed        int = 10401
 )
@@ -121,7 +128,12 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 				return err_open
 			}
 		}
-		c.listener <- &i
+		c.publish(&i)
+		if i.Code != 0 {
+			c.handleInfoCode(socketId, &i)
+		} else if i.Platform.Status == 1 {
+			c.handlePlatformOperative(socketId)
+		}
 	case "auth":
 		a := AuthEvent{}
 		err = json.Unmarshal(msg, &a)
@@ -134,8 +146,16 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 			c.Authentication = RejectedAuthentication
 		}
 		c.handleAuthAck(socketId, &a)
-		c.listener <- &a
+		c.publish(&a)
 		return nil
+	case "unauth":
+		u := UnauthEvent{}
+		err = json.Unmarshal(msg, &u)
+		if err != nil {
+			return err
+		}
+		c.publish(&u)
+		return c.handleUnauthAck(socketId, &u)
 	case "subscribed":
 		s := SubscribeEvent{}
 		err = json.Unmarshal(msg, &s)
@@ -146,7 +166,8 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 		if err != nil {
 			return err
 		}
-		c.listener <- &s
+		c.pendingSubs.resolve(s.SubID, &s, nil)
+		c.publish(&s)
 		return nil
 	case "unsubscribed":
 		s := UnsubscribeEvent{}
@@ -154,25 +175,41 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 		if err != nil {
 			return err
 		}
-		err_rem := c.subscriptions.removeByChannelID(s.ChanID)
+		sub, err_rem := c.subscriptions.removeByChannelID(s.ChanID)
 		if err_rem != nil {
 			return err_rem
 		}
-		c.listener <- &s
+		c.releaseBook(sub)
+		c.publish(&s)
 	case "error":
 		er := ErrorEvent{}
 		err = json.Unmarshal(msg, &er)
 		if err != nil {
 			return err
 		}
-		c.listener <- &er
+		if er.SubID != "" {
+			// a rejected subscription never becomes active
+			if sub, ok := c.subscriptions.removePending(er.SubID); ok {
+				c.releaseBook(sub)
+			}
+			c.pendingSubs.resolve(er.SubID, nil, er.Err())
+		}
+		c.publish(&er)
+	case "pong":
+		p := PongEvent{}
+		err = json.Unmarshal(msg, &p)
+		if err != nil {
+			return err
+		}
+		c.handlePong(socketId, &p)
+		c.publish(&p)
 	case "conf":
 		ec := ConfEvent{}
 		err = json.Unmarshal(msg, &ec)
 		if err != nil {
 			return err
 		}
-		c.listener <- &ec
+		c.publish(&ec)
 	default:
 		c.log.Warningf("unknown event: %s", msg)
 	}
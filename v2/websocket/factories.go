@@ -4,15 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	"sync"
 
 	"github.com/bitfinexcom/bitfinex-api-go/pkg/convert"
 	"github.com/bitfinexcom/bitfinex-api-go/v2"
 )
 
 type messageFactory interface {
-	Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error)
-	BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error)
+	Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error)
+	BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error)
 }
 
 type TickerFactory struct {
@@ -25,16 +24,26 @@ func newTickerFactory(subs *subscriptions) *TickerFactory {
 	}
 }
 
-func (f *TickerFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error) {
-	return bitfinex.NewTickerFromRaw(sub.Request.Symbol, raw)
+func (f *TickerFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
+	ticker, err := bitfinex.NewTickerFromRaw(sub.Request.Symbol, raw)
+	if err != nil {
+		return nil, err
+	}
+	ticker.UpdateTimestamp = ts
+	return ticker, nil
 }
 
-func (f *TickerFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *TickerFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	converted, err := convert.ToFloat64Array(raw)
 	if err != nil {
 		return nil, err
 	}
-	return bitfinex.NewTickerSnapshotFromRaw(sub.Request.Symbol, converted)
+	snap, err := bitfinex.NewTickerSnapshotFromRaw(sub.Request.Symbol, converted)
+	if err != nil {
+		return nil, err
+	}
+	snap.UpdateTimestamp = ts
+	return snap, nil
 }
 
 type TradeFactory struct {
@@ -47,36 +56,51 @@ func newTradeFactory(subs *subscriptions) *TradeFactory {
 	}
 }
 
-func (f *TradeFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *TradeFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	if "tu" == objType {
 		return nil, nil // do not process TradeUpdate messages on public feed, only need to process TradeExecution (first copy seen)
 	}
-	return bitfinex.NewTradeFromRaw(sub.Request.Symbol, raw)
+	trade, err := bitfinex.NewTradeFromRaw(sub.Request.Symbol, raw)
+	if err != nil {
+		return nil, err
+	}
+	trade.UpdateTimestamp = ts
+	return trade, nil
 }
 
-func (f *TradeFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *TradeFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	converted, err := convert.ToFloat64Array(raw)
 	if err != nil {
 		return nil, err
 	}
-	return bitfinex.NewTradeSnapshotFromRaw(sub.Request.Symbol, converted)
+	snap, err := bitfinex.NewTradeSnapshotFromRaw(sub.Request.Symbol, converted)
+	if err != nil {
+		return nil, err
+	}
+	snap.UpdateTimestamp = ts
+	return snap, nil
 }
 
 type BookFactory struct {
 	*subscriptions
-	orderbooks  map[string]*Orderbook
+	books       *managedBooks
 	manageBooks bool
-	lock        sync.Mutex
 }
 
-func newBookFactory(subs *subscriptions, obs map[string]*Orderbook, manageBooks bool) *BookFactory {
+func newBookFactory(subs *subscriptions, books *managedBooks, manageBooks bool) *BookFactory {
 	return &BookFactory{
 		subscriptions: subs,
-		orderbooks:    obs,
+		books:         books,
 		manageBooks:   manageBooks,
 	}
 }
 
+// bookKey identifies a managed book by its subscription parameters, so books of the
+// same symbol at different precisions, frequencies or lengths are kept apart
+func bookKey(req *SubscriptionRequest) string {
+	return strings.Join([]string{req.Symbol, req.Precision, req.Frequency, req.Len}, ":")
+}
+
 func ConvertBytesToJsonNumberArray(raw_bytes []byte) ([]interface{}, error) {
 	var raw_json_number []interface{}
 	d := json.NewDecoder(strings.NewReader(string(raw_bytes)))
@@ -88,7 +112,7 @@ func ConvertBytesToJsonNumberArray(raw_bytes []byte) ([]interface{}, error) {
 	return raw_json_number, nil
 }
 
-func (f *BookFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *BookFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	// we need ot parse the bytes using json numbers since they store the exact string value
 	// and not a float64 representation
 	raw_json_number, str_conv_err := ConvertBytesToJsonNumberArray(raw_bytes)
@@ -96,18 +120,47 @@ func (f *BookFactory) Build(sub *subscription, objType string, raw []interface{}
 		return nil, str_conv_err
 	}
 
+	if bitfinex.IsFundingSymbol(sub.Request.Symbol) {
+		return f.buildFunding(sub, raw, raw_json_number[1], ts)
+	}
 	update, err := bitfinex.NewBookUpdateFromRaw(sub.Request.Symbol, sub.Request.Precision, raw, raw_json_number[1])
+	if err != nil {
+		return nil, err
+	}
+	// stamp before the update is shared with the managed book
+	update.UpdateTimestamp = ts
 	if f.manageBooks {
-		f.lock.Lock()
-		defer f.lock.Unlock()
-		if orderbook, ok := f.orderbooks[sub.Request.Symbol]; ok {
-			orderbook.UpdateWith(update)
+		// observers may call back into the client, notify them once the
+		// books lock has been released
+		if orderbook, ev := f.updateBook(sub.Request, update); ev != nil {
+			orderbook.observers.notify(ev)
 		}
 	}
 	return update, err
 }
 
-func (f *BookFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error) {
+// updateBook applies the update to the managed book and returns the event for
+// its observers, if any
+func (f *BookFactory) updateBook(req *SubscriptionRequest, update *bitfinex.BookUpdate) (*Orderbook, *OrderbookEvent) {
+	f.books.lock.Lock()
+	defer f.books.lock.Unlock()
+	key := bookKey(req)
+	if f.books.holdBack(key, update) {
+		return nil, nil
+	}
+	if bitfinex.IsRawBook(req.Precision) {
+		if orderbook, ok := f.books.raw[key]; ok {
+			orderbook.UpdateWith(update)
+		}
+		return nil, nil
+	}
+	if orderbook, ok := f.books.books[key]; ok {
+		return orderbook, orderbook.updateWith(update)
+	}
+	return nil, nil
+}
+
+func (f *BookFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	converted, err := convert.ToFloat64Array(raw)
 	if err != nil {
 		return nil, err
@@ -118,24 +171,83 @@ func (f *BookFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_
 		return nil, str_conv_err
 	}
 
+	if bitfinex.IsFundingSymbol(sub.Request.Symbol) {
+		return f.buildFundingSnapshot(sub, converted, raw_json_number[1], ts)
+	}
 	update, err2 := bitfinex.NewBookUpdateSnapshotFromRaw(sub.Request.Symbol, sub.Request.Precision, converted, raw_json_number[1])
 	if err2 != nil {
 		return nil, err2
 	}
+	update.UpdateTimestamp = ts
 	if f.manageBooks {
-		f.lock.Lock()
-		defer f.lock.Unlock()
-		// create new orderbook
-		f.orderbooks[sub.Request.Symbol] = &Orderbook{
-			symbol: sub.Request.Symbol,
-			bids:   make([]*bitfinex.BookUpdate, 0),
-			asks:   make([]*bitfinex.BookUpdate, 0),
+		if orderbook, ev := f.snapshotBook(sub.Request, update); ev != nil {
+			orderbook.observers.notify(ev)
 		}
-		f.orderbooks[sub.Request.Symbol].SetWithSnapshot(update)
 	}
 	return update, err
 }
 
+// snapshotBook replaces the managed book with the snapshot and returns the event
+// for its observers, if any
+func (f *BookFactory) snapshotBook(req *SubscriptionRequest, snapshot *bitfinex.BookUpdateSnapshot) (*Orderbook, *OrderbookEvent) {
+	f.books.lock.Lock()
+	defer f.books.lock.Unlock()
+	// reuse the managed book of a resubscription to keep its observers and counters,
+	// the snapshot supersedes a pending reseed
+	key := bookKey(req)
+	delete(f.books.reseeding, key)
+	if bitfinex.IsRawBook(req.Precision) {
+		if _, ok := f.books.raw[key]; !ok {
+			f.books.raw[key] = newRawOrderbook(req.Symbol)
+		}
+		f.books.raw[key].SetWithSnapshot(snapshot)
+		return nil, nil
+	}
+	orderbook, ok := f.books.books[key]
+	if !ok {
+		orderbook = newOrderbook(req.Symbol)
+		f.books.books[key] = orderbook
+	}
+	return orderbook, orderbook.setWithSnapshot(snapshot)
+}
+
+func (f *BookFactory) buildFunding(sub *subscription, raw []interface{}, raw_numbers interface{}, ts bitfinex.UpdateTimestamp) (interface{}, error) {
+	update, err := bitfinex.NewFundingBookUpdateFromRaw(sub.Request.Symbol, sub.Request.Precision, raw, raw_numbers)
+	if err != nil {
+		return nil, err
+	}
+	update.UpdateTimestamp = ts
+	if f.manageBooks {
+		f.books.lock.Lock()
+		defer f.books.lock.Unlock()
+		if orderbook, ok := f.books.funding[bookKey(sub.Request)]; ok {
+			orderbook.UpdateWith(update)
+		}
+	}
+	return update, nil
+}
+
+func (f *BookFactory) buildFundingSnapshot(sub *subscription, raw [][]float64, raw_numbers interface{}, ts bitfinex.UpdateTimestamp) (interface{}, error) {
+	snapshot, err := bitfinex.NewFundingBookUpdateSnapshotFromRaw(sub.Request.Symbol, sub.Request.Precision, raw, raw_numbers)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.UpdateTimestamp = ts
+	if f.manageBooks {
+		f.books.lock.Lock()
+		defer f.books.lock.Unlock()
+		// reuse the managed book of a resubscription to keep its counters
+		key := bookKey(sub.Request)
+		orderbook, ok := f.books.funding[key]
+		if !ok {
+			orderbook = newFundingOrderbook(sub.Request.Symbol, bitfinex.IsRawBook(sub.Request.Precision))
+			f.books.funding[key] = orderbook
+		}
+		orderbook.SetWithSnapshot(snapshot)
+	}
+	return snapshot, nil
+}
+
 type CandlesFactory struct {
 	*subscriptions
 }
@@ -146,16 +258,20 @@ func newCandlesFactory(subs *subscriptions) *CandlesFactory {
 	}
 }
 
-func (f *CandlesFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *CandlesFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	sym, res, err := extractSymbolResolutionFromKey(sub.Request.Key)
 	if err != nil {
 		return nil, err
 	}
 	candle, err := bitfinex.NewCandleFromRaw(sym, res, raw)
-	return candle, err
+	if err != nil {
+		return nil, err
+	}
+	candle.UpdateTimestamp = ts
+	return candle, nil
 }
 
-func (f *CandlesFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *CandlesFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	converted, err := convert.ToFloat64Array(raw)
 	if err != nil {
 		return nil, err
@@ -165,7 +281,11 @@ func (f *CandlesFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, r
 		return nil, err
 	}
 	snap, err := bitfinex.NewCandleSnapshotFromRaw(sym, res, converted)
-	return snap, err
+	if err != nil {
+		return nil, err
+	}
+	snap.UpdateTimestamp = ts
+	return snap, nil
 }
 
 type StatsFactory struct {
@@ -178,17 +298,21 @@ func newStatsFactory(subs *subscriptions) *StatsFactory {
 	}
 }
 
-func (f *StatsFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *StatsFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	splits := strings.Split(sub.Request.Key, ":")
 	if len(splits) != 3 {
 		return nil, fmt.Errorf("unable to parse key to symbol %s", sub.Request.Key)
 	}
 	symbol := splits[1] + ":" + splits[2]
-	candle, err := bitfinex.NewDerivativeStatusFromWsRaw(symbol, raw)
-	return candle, err
+	status, err := bitfinex.NewDerivativeStatusFromWsRaw(symbol, raw)
+	if err != nil {
+		return nil, err
+	}
+	status.UpdateTimestamp = ts
+	return status, nil
 }
 
-func (f *StatsFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error) {
+func (f *StatsFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte, ts bitfinex.UpdateTimestamp) (interface{}, error) {
 	// no snapshots
 	return nil, nil
 }
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// FundingOrderbook is the book of a funding symbol (i.e. fUSD) which is managed locally.
+// Aggregated entries are keyed by rate and period, raw (R0) entries by offer ID.
+type FundingOrderbook struct {
+	mismatchCounter
+	lock sync.RWMutex
+
+	symbol string
+	raw    bool
+	offers map[int64]*bitfinex.FundingBookUpdate // raw books only
+	bids   priceLevels                           // keyed by negated rate, highest rate first
+	asks   priceLevels                           // keyed by rate, lowest rate first
+}
+
+func newFundingOrderbook(symbol string, raw bool) *FundingOrderbook {
+	return &FundingOrderbook{
+		symbol: symbol,
+		raw:    raw,
+		offers: make(map[int64]*bitfinex.FundingBookUpdate),
+	}
+}
+
+func (ob *FundingOrderbook) Symbol() string {
+	return ob.symbol
+}
+
+// IsRaw checks if the book is managed from a raw (R0) subscription.
+func (ob *FundingOrderbook) IsRaw() bool {
+	return ob.raw
+}
+
+func (ob *FundingOrderbook) key(fu *bitfinex.FundingBookUpdate) (*priceLevels, levelKey) {
+	side, sign := &ob.asks, 1.0
+	if fu.Side == bitfinex.Bid {
+		side, sign = &ob.bids, -1.0
+	}
+	if ob.raw {
+		return side, levelKey{price: sign * fu.Rate, id: fu.ID}
+	}
+	return side, levelKey{price: sign * fu.Rate, id: fu.Period}
+}
+
+func (ob *FundingOrderbook) copySide(side *priceLevels, n int) []bitfinex.FundingBookUpdate {
+	size := side.len()
+	if n >= 0 && n < size {
+		size = n
+	}
+	cpy := make([]bitfinex.FundingBookUpdate, 0, size)
+	side.each(n, func(entry interface{}) bool {
+		cpy = append(cpy, *entry.(*bitfinex.FundingBookUpdate))
+		return true
+	})
+	return cpy
+}
+
+// Asks returns all offers, ordered from the lowest rate.
+func (ob *FundingOrderbook) Asks() []bitfinex.FundingBookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.copySide(&ob.asks, -1)
+}
+
+// Bids returns all bids, ordered from the highest rate.
+func (ob *FundingOrderbook) Bids() []bitfinex.FundingBookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.copySide(&ob.bids, -1)
+}
+
+// TopAsks returns the best n offers without copying the remaining book.
+func (ob *FundingOrderbook) TopAsks(n int) []bitfinex.FundingBookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if n < 0 {
+		n = 0
+	}
+	return ob.copySide(&ob.asks, n)
+}
+
+// TopBids returns the best n bids without copying the remaining book.
+func (ob *FundingOrderbook) TopBids(n int) []bitfinex.FundingBookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if n < 0 {
+		n = 0
+	}
+	return ob.copySide(&ob.bids, n)
+}
+
+func (ob *FundingOrderbook) SetWithSnapshot(bs *bitfinex.FundingBookUpdateSnapshot) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	ob.offers = make(map[int64]*bitfinex.FundingBookUpdate)
+	ob.bids.reset()
+	ob.asks.reset()
+	for _, entry := range bs.Snapshot {
+		if ob.raw {
+			ob.offers[entry.ID] = entry
+		}
+		side, key := ob.key(entry)
+		side.set(key, entry)
+	}
+}
+
+func (ob *FundingOrderbook) UpdateWith(fu *bitfinex.FundingBookUpdate) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	if ob.raw {
+		// raw removals carry no rate, locate the offer by its ID
+		if existing, ok := ob.offers[fu.ID]; ok {
+			side, key := ob.key(existing)
+			side.remove(key)
+			delete(ob.offers, fu.ID)
+		}
+		if fu.Action == bitfinex.BookRemoveEntry {
+			return
+		}
+		ob.offers[fu.ID] = fu
+	}
+	side, key := ob.key(fu)
+	if fu.Action == bitfinex.BookRemoveEntry {
+		side.remove(key)
+		return
+	}
+	side.set(key, fu)
+}
+
+// Checksum calculates the book checksum from the rate, or the offer ID of raw
+// books, and the amount of the top entries.
+func (ob *FundingOrderbook) Checksum() uint32 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return bookChecksum(&ob.bids, &ob.asks, func(entry interface{}) (string, string) {
+		fu := entry.(*bitfinex.FundingBookUpdate)
+		if ob.raw {
+			return strconv.FormatInt(fu.ID, 10), fu.AmountJsNum.String()
+		}
+		return fu.RateJsNum.String(), fu.AmountJsNum.String()
+	})
+}
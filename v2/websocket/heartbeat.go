@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// HeartbeatAction is the recovery chosen for a channel which missed its
+// heartbeat deadline.
+type HeartbeatAction int
+
+const (
+	// HeartbeatResubscribe resubscribes the stale channel, other channels of the
+	// socket are left untouched.
+	HeartbeatResubscribe HeartbeatAction = iota
+	// HeartbeatReconnect reconnects the socket of the stale channel.
+	HeartbeatReconnect
+)
+
+func (a HeartbeatAction) String() string {
+	switch a {
+	case HeartbeatResubscribe:
+		return "resubscribe"
+	case HeartbeatReconnect:
+		return "reconnect"
+	}
+	return "unknown"
+}
+
+// HeartbeatRecovery is published when a channel missed its heartbeat deadline,
+// with the recovery decided for it. Only the stale channel is resubscribed,
+// unless the socket was silent, HeartbeatEscalation channels of the socket are
+// stale or the authenticated channel is stale; the socket is reconnected then.
+type HeartbeatRecovery struct {
+	SocketId SocketId
+	SubID    string
+	ChanID   int64
+	Channel  string
+	Symbol   string
+	Action   HeartbeatAction
+	Stale    int  // stale channels of the socket, including this one
+	Silent   bool // no message was received on the socket within the heartbeat timeout
+	Error    error
+}
+
+// touch records a message received on the socket
+func (s *Socket) touch(t time.Time) {
+	atomic.StoreInt64(&s.lastMessage, t.UnixNano())
+}
+
+// silent returns true if no message was received on the socket for the duration
+func (s *Socket) silent(d time.Duration) bool {
+	last := atomic.LoadInt64(&s.lastMessage)
+	return time.Since(time.Unix(0, last)) > d
+}
+
+// recoverHeartbeat resubscribes the channel which missed its heartbeat, or
+// reconnects its socket if the outage is not limited to the channel
+func (c *Client) recoverHeartbeat(hb HeartbeatDisconnect) {
+	sub := hb.Subscription
+	c.mtx.RLock()
+	socket, ok := c.sockets[sub.SocketId]
+	connected := ok && socket.IsConnected
+	c.mtx.RUnlock()
+	if !connected {
+		return
+	}
+	ev := &HeartbeatRecovery{
+		SocketId: sub.SocketId,
+		SubID:    sub.SubID(),
+		ChanID:   sub.ChanID,
+		Channel:  sub.Request.Channel,
+		Symbol:   sub.Request.Symbol,
+		Action:   HeartbeatResubscribe,
+		Stale:    c.subscriptions.staleCount(sub.SocketId),
+		Silent:   socket.silent(c.parameters.HeartbeatTimeout),
+		Error:    hb.Error,
+	}
+	// the authenticated channel can not be resubscribed
+	if ev.Silent || !sub.Public || ev.Stale >= c.parameters.HeartbeatEscalation {
+		ev.Action = HeartbeatReconnect
+	}
+	c.log.Warningf("heartbeat %s on socket (id=%d): %s", ev.Action, ev.SocketId, hb.Error.Error())
+	c.publishLifecycleEvent(ev)
+
+	if ev.Action == HeartbeatReconnect {
+		c.mtx.Lock()
+		if socket.IsConnected {
+			c.restartSocket(socket, hb.Error)
+		}
+		c.mtx.Unlock()
+		return
+	}
+	if err := c.resubscribe(sub); err != nil {
+		c.log.Errorf("could not resubscribe %s: %s", sub.Request.String(), err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"time"
+)
+
+// Connection lifecycle events are published on the Listen() channel so that
+// consumers can react to outages, i.e. pause trading while reconnecting.
+
+// SocketConnected is published when a socket connection has been established,
+// including re-established connections after a reconnect.
+type SocketConnected struct {
+	SocketId SocketId
+}
+
+// SocketDisconnected is published when a socket connection dropped unexpectedly
+// or was closed due to a heartbeat timeout.
+type SocketDisconnected struct {
+	SocketId SocketId
+	Error    error
+}
+
+// Reconnecting is published before every reconnect attempt.
+type Reconnecting struct {
+	SocketId    SocketId
+	Attempt     int
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+// ReconnectFailed is published when all reconnect attempts have failed. The
+// socket will not be reconnected.
+type ReconnectFailed struct {
+	SocketId SocketId
+	Attempts int
+	Error    error
+}
+
+// Resubscribed is published once the subscriptions of a reconnected socket
+// have been re-submitted.
+type Resubscribed struct {
+	SocketId      SocketId
+	Subscriptions int
+}
+
+// publishLifecycleEvent publishes the event unless the client is shutting down
+func (c *Client) publishLifecycleEvent(ev interface{}) {
+	if c.isTerminal() {
+		return
+	}
+	c.publish(ev)
+}
+
+// offerLifecycleEvent publishes the event without blocking the caller, i.e.
+// the read routine of a socket, on a full listener
+func (c *Client) offerLifecycleEvent(ev interface{}) {
+	if c.isTerminal() {
+		return
+	}
+	c.listener.offer(ev)
+}
+
+// isTerminal returns true once the client has been closed
+func (c *Client) isTerminal() bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.terminal
+}
+
+func (c *Client) reconnectBackoff() BackoffStrategy {
+	if c.parameters.ReconnectBackoff != nil {
+		return c.parameters.ReconnectBackoff
+	}
+	return &ConstantBackoff{Interval: c.parameters.ReconnectInterval}
+}
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+)
+
+// info codes sent by the platform
+const (
+	InfoCodeReconnect        int = 20051 // stop/restart websocket server, please reconnect
+	InfoCodeMaintenanceStart int = 20060 // entering maintenance mode, pause any activity
+	InfoCodeMaintenanceEnd   int = 20061 // maintenance ended, resubscribe to all channels
+)
+
+// ErrMaintenance is returned for requests submitted while the platform is in
+// maintenance mode
+var ErrMaintenance = errors.New("platform is in maintenance mode")
+
+// MaintenanceStarted is published when the platform enters maintenance mode.
+// Requests are rejected with ErrMaintenance until MaintenanceEnded is published.
+type MaintenanceStarted struct {
+	SocketId SocketId
+}
+
+// MaintenanceEnded is published when the platform left maintenance mode and the
+// public channels of the socket have been resubscribed. The platform notifies
+// every connection, so it is published once per socket. A socket which (re)opens
+// on an operative platform ends a maintenance it missed without resubscribing,
+// its channels are resubscribed by the reconnect.
+type MaintenanceEnded struct {
+	SocketId      SocketId
+	Subscriptions int // resubscribed channels
+}
+
+// InMaintenance returns true while the platform is in maintenance mode
+func (c *Client) InMaintenance() bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.maintenance
+}
+
+// setMaintenance returns true if the maintenance mode changed
+func (c *Client) setMaintenance(maintenance bool) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	changed := c.maintenance != maintenance
+	c.maintenance = maintenance
+	return changed
+}
+
+// getTradingSocket returns the authenticated socket unless requests are paused
+// for maintenance
+func (c *Client) getTradingSocket() (*Socket, error) {
+	if c.InMaintenance() {
+		return nil, ErrMaintenance
+	}
+	return c.GetAuthenticatedSocket()
+}
+
+// called when an info event with a code is received
+func (c *Client) handleInfoCode(socketId SocketId, info *InfoEvent) {
+	switch info.Code {
+	case InfoCodeReconnect:
+		c.log.Infof("socket (id=%d) reconnect requested: %s", socketId, info.Msg)
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		if socket, ok := c.sockets[socketId]; ok && socket.IsConnected {
+			c.restartSocket(socket, fmt.Errorf("reconnect requested by the platform (%d)", info.Code))
+		}
+	case InfoCodeMaintenanceStart:
+		c.log.Warningf("socket (id=%d) platform entering maintenance: %s", socketId, info.Msg)
+		c.setMaintenance(true)
+		c.publish(&MaintenanceStarted{SocketId: socketId})
+	case InfoCodeMaintenanceEnd:
+		c.log.Infof("socket (id=%d) platform maintenance ended: %s", socketId, info.Msg)
+		c.setMaintenance(false)
+		// every socket receives the maintenance end and resubscribes its own
+		// channels, resubscribing all sockets here would repeat it per socket
+		resubscribed := c.resubscribePublic(socketId)
+		c.publish(&MaintenanceEnded{SocketId: socketId, Subscriptions: resubscribed})
+	}
+}
+
+// called when an info event reports the platform as operative, i.e. on a socket
+// which reconnected during maintenance and missed its end
+func (c *Client) handlePlatformOperative(socketId SocketId) {
+	if !c.setMaintenance(false) {
+		return
+	}
+	c.log.Infof("socket (id=%d) platform is operative, maintenance ended", socketId)
+	c.publish(&MaintenanceEnded{SocketId: socketId})
+}
@@ -0,0 +1,249 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// notification request errors
+var (
+	ErrMissingCID = errors.New("order request requires a client order ID (CID) to match its notification")
+	ErrMissingID  = errors.New("order request requires an order ID or client order ID (CID) to match its notification")
+)
+
+// Notification statuses which signal that a request was rejected by the platform
+const (
+	NotificationStatusError   = "ERROR"
+	NotificationStatusFailure = "FAILURE"
+)
+
+// NotificationError is returned when a submitted request is answered with an
+// ERROR or FAILURE notification. The original notification is retained so the
+// rejection reason (Text) and the notify info can be inspected.
+type NotificationError struct {
+	Notification *bitfinex.Notification
+}
+
+func (e *NotificationError) Error() string {
+	return fmt.Sprintf("%s rejected with status %s: %s", e.Notification.Type, e.Notification.Status, e.Notification.Text)
+}
+
+func isRejected(n *bitfinex.Notification) bool {
+	return n.Status == NotificationStatusError || n.Status == NotificationStatusFailure
+}
+
+// pendingRequests correlates outgoing requests with the notifications that are
+// sent in response on the authenticated channel.
+type pendingRequests struct {
+	lock    sync.Mutex
+	waiters map[string][]chan *bitfinex.Notification
+}
+
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{
+		waiters: make(map[string][]chan *bitfinex.Notification),
+	}
+}
+
+func notificationKey(nType, idType string, id int64) string {
+	return fmt.Sprintf("%s:%s:%d", nType, idType, id)
+}
+
+// add registers a new waiter for the given key. The returned channel receives
+// at most one notification.
+func (p *pendingRequests) add(key string) chan *bitfinex.Notification {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	ch := make(chan *bitfinex.Notification, 1)
+	p.waiters[key] = append(p.waiters[key], ch)
+	return ch
+}
+
+// remove drops the given waiter, i.e. when its context expired before a
+// notification was received
+func (p *pendingRequests) remove(key string, ch chan *bitfinex.Notification) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	waiters := p.waiters[key]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(p.waiters, key)
+		return
+	}
+	p.waiters[key] = waiters
+}
+
+// resolve delivers the notification to the oldest waiter of every key
+// which can be derived from it
+func (p *pendingRequests) resolve(n *bitfinex.Notification) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, key := range notificationKeys(n) {
+		waiters, ok := p.waiters[key]
+		if !ok || len(waiters) == 0 {
+			continue
+		}
+		waiters[0] <- n
+		if len(waiters) == 1 {
+			delete(p.waiters, key)
+		} else {
+			p.waiters[key] = waiters[1:]
+		}
+	}
+}
+
+// notificationKeys returns the keys a notification can be matched by.
+// New orders are matched by CID, updates by ID and cancels by either.
+// Multi-op and multi cancel requests are matched by their type.
+func notificationKeys(n *bitfinex.Notification) []string {
+	keys := make([]string, 0)
+	switch n.Type {
+	case "ox_multi-req", "oc_multi-req":
+		// multi requests carry no IDs, they are answered in the order they were sent
+		return append(keys, n.Type)
+	}
+	switch info := n.NotifyInfo.(type) {
+	case *bitfinex.OrderNew:
+		keys = append(keys, notificationKey(n.Type, "cid", info.CID))
+	case *bitfinex.OrderSnapshot:
+		for _, o := range info.Snapshot {
+			keys = append(keys, notificationKey(n.Type, "cid", o.CID))
+		}
+	case *bitfinex.OrderUpdate:
+		keys = append(keys, notificationKey(n.Type, "id", info.ID))
+	case *bitfinex.OrderCancel:
+		keys = append(keys, notificationKey(n.Type, "id", info.ID))
+		if info.CID != 0 {
+			keys = append(keys, notificationKey(n.Type, "cid", info.CID))
+		}
+	}
+	return keys
+}
+
+// sendAndWait sends the given message over the authenticated socket and blocks
+// until a notification matching the key is received or the context expires.
+func (c *Client) sendAndWait(ctx context.Context, key string, msg interface{}) (*bitfinex.Notification, error) {
+	socket, err := c.getTradingSocket()
+	if err != nil {
+		return nil, err
+	}
+	// register before sending so a fast response can not be missed
+	ch := c.pending.add(key)
+	if err := socket.Asynchronous.Send(ctx, msg); err != nil {
+		c.pending.remove(key, ch)
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		c.pending.remove(key, ch)
+		return nil, ctx.Err()
+	case n := <-ch:
+		if isRejected(n) {
+			return nil, &NotificationError{Notification: n}
+		}
+		return n, nil
+	}
+}
+
+// SubmitOrderAndWait submits a new order and waits for the matching on-req
+// notification. The order must carry a CID, which is used to match the
+// notification. A rejected order returns a *NotificationError.
+func (c *Client) SubmitOrderAndWait(ctx context.Context, order *bitfinex.OrderNewRequest) (*bitfinex.OrderNew, error) {
+	if order.CID == 0 {
+		return nil, ErrMissingCID
+	}
+	n, err := c.sendAndWait(ctx, notificationKey("on-req", "cid", order.CID), order)
+	if err != nil {
+		return nil, err
+	}
+	switch info := n.NotifyInfo.(type) {
+	case *bitfinex.OrderNew:
+		return info, nil
+	case *bitfinex.OrderSnapshot:
+		// OCO orders are acknowledged as a set
+		for _, o := range info.Snapshot {
+			if o.CID == order.CID {
+				on := bitfinex.OrderNew(*o)
+				return &on, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected notify info for %s: %#v", n.Type, n.NotifyInfo)
+}
+
+// SubmitUpdateOrderAndWait submits an order update and waits for the matching
+// ou-req notification. A rejected update returns a *NotificationError.
+func (c *Client) SubmitUpdateOrderAndWait(ctx context.Context, orderUpdate *bitfinex.OrderUpdateRequest) (*bitfinex.OrderUpdate, error) {
+	if orderUpdate.ID == 0 {
+		return nil, ErrMissingID
+	}
+	n, err := c.sendAndWait(ctx, notificationKey("ou-req", "id", orderUpdate.ID), orderUpdate)
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := n.NotifyInfo.(*bitfinex.OrderUpdate); ok {
+		return info, nil
+	}
+	return nil, fmt.Errorf("unexpected notify info for %s: %#v", n.Type, n.NotifyInfo)
+}
+
+// SubmitCancelAndWait submits a cancel request and waits for the matching
+// oc-req notification. The cancel is matched by ID, or by CID when no ID is
+// given. A rejected cancel returns a *NotificationError.
+func (c *Client) SubmitCancelAndWait(ctx context.Context, cancel *bitfinex.OrderCancelRequest) (*bitfinex.OrderCancel, error) {
+	var key string
+	switch {
+	case cancel.ID != 0:
+		key = notificationKey("oc-req", "id", cancel.ID)
+	case cancel.CID != 0:
+		key = notificationKey("oc-req", "cid", cancel.CID)
+	default:
+		return nil, ErrMissingID
+	}
+	n, err := c.sendAndWait(ctx, key, cancel)
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := n.NotifyInfo.(*bitfinex.OrderCancel); ok {
+		return info, nil
+	}
+	return nil, fmt.Errorf("unexpected notify info for %s: %#v", n.Type, n.NotifyInfo)
+}
+
+// SubmitOrderMultiOpAndWait submits the order operations in a single message and
+// waits for the ox_multi-req notification, which holds one notification per
+// operation. A rejected request returns a *NotificationError, operations may
+// still be rejected individually.
+func (c *Client) SubmitOrderMultiOpAndWait(ctx context.Context, multiOp *bitfinex.OrderMultiOpRequest) (*bitfinex.NotificationSnapshot, error) {
+	n, err := c.sendAndWait(ctx, "ox_multi-req", multiOp)
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := n.NotifyInfo.(*bitfinex.NotificationSnapshot); ok {
+		return info, nil
+	}
+	return nil, fmt.Errorf("unexpected notify info for %s: %#v", n.Type, n.NotifyInfo)
+}
+
+// SubmitCancelMultiAndWait submits a multi cancel request and waits for the
+// oc_multi-req notification, which holds the cancelled orders. A rejected
+// cancel returns a *NotificationError.
+func (c *Client) SubmitCancelMultiAndWait(ctx context.Context, cancel *bitfinex.OrderMultiCancelRequest) (*bitfinex.OrderSnapshot, error) {
+	n, err := c.sendAndWait(ctx, "oc_multi-req", cancel)
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := n.NotifyInfo.(*bitfinex.OrderSnapshot); ok {
+		return info, nil
+	}
+	return nil, fmt.Errorf("unexpected notify info for %s: %#v", n.Type, n.NotifyInfo)
+}
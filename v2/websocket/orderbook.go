@@ -1,28 +1,46 @@
 package websocket
 
 import (
-	"github.com/bitfinexcom/bitfinex-api-go/v2"
+	"hash/crc32"
 	"sort"
-	"sync"
 	"strings"
-	"hash/crc32"
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
 )
 
+// number of price levels per side covered by the book checksum
+const checksumDepth = 25
+
 type Orderbook struct {
+	mismatchCounter
 	lock sync.RWMutex
 
 	symbol string
-	bids   []*bitfinex.BookUpdate
-	asks   []*bitfinex.BookUpdate
+	bids   priceLevels // keyed by negated price, highest bid first
+	asks   priceLevels // keyed by price, lowest ask first
+
+	observers bookObservers
+}
+
+func newOrderbook(symbol string) *Orderbook {
+	return &Orderbook{
+		symbol: symbol,
+	}
 }
 
-// return a dereferenced copy of an orderbook side. This is so consumers can access
-// the book but not change the values that are used to generate the crc32 checksum
-func (ob *Orderbook) copySide(side []*bitfinex.BookUpdate) []bitfinex.BookUpdate {
-	var cpy []bitfinex.BookUpdate
-	for i := 0; i < len(side); i++ {
-		cpy = append(cpy, *side[i])
+// return a dereferenced copy of the first n entries of an orderbook side. This is so consumers
+// can access the book but not change the values that are used to generate the crc32 checksum
+func (ob *Orderbook) copySide(side *priceLevels, n int) []bitfinex.BookUpdate {
+	size := side.len()
+	if n >= 0 && n < size {
+		size = n
 	}
+	cpy := make([]bitfinex.BookUpdate, 0, size)
+	side.each(n, func(entry interface{}) bool {
+		cpy = append(cpy, *entry.(*bitfinex.BookUpdate))
+		return true
+	})
 	return cpy
 }
 
@@ -30,95 +48,191 @@ func (ob *Orderbook) Symbol() string {
 	return ob.symbol
 }
 
+// Asks returns all asks, ordered from the lowest price.
 func (ob *Orderbook) Asks() []bitfinex.BookUpdate {
 	ob.lock.RLock()
 	defer ob.lock.RUnlock()
-	return ob.copySide(ob.asks)
+	return ob.copySide(&ob.asks, -1)
 }
 
+// Bids returns all bids, ordered from the highest price.
 func (ob *Orderbook) Bids() []bitfinex.BookUpdate {
 	ob.lock.RLock()
 	defer ob.lock.RUnlock()
-	return ob.copySide(ob.bids)
+	return ob.copySide(&ob.bids, -1)
+}
+
+// TopAsks returns the best n asks without copying the remaining book.
+func (ob *Orderbook) TopAsks(n int) []bitfinex.BookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if n < 0 {
+		n = 0
+	}
+	return ob.copySide(&ob.asks, n)
+}
+
+// TopBids returns the best n bids without copying the remaining book.
+func (ob *Orderbook) TopBids(n int) []bitfinex.BookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if n < 0 {
+		n = 0
+	}
+	return ob.copySide(&ob.bids, n)
+}
+
+func (ob *Orderbook) side(s bitfinex.OrderSide) (*priceLevels, float64) {
+	if s == bitfinex.Bid {
+		return &ob.bids, -1
+	}
+	return &ob.asks, 1
 }
 
 func (ob *Orderbook) SetWithSnapshot(bs *bitfinex.BookUpdateSnapshot) {
+	// observers are notified once the lock has been released
+	ob.observers.notify(ob.setWithSnapshot(bs))
+}
+
+func (ob *Orderbook) setWithSnapshot(bs *bitfinex.BookUpdateSnapshot) *OrderbookEvent {
 	ob.lock.Lock()
 	defer ob.lock.Unlock()
 
-	ob.bids = make([]*bitfinex.BookUpdate, 0)
-	ob.asks = make([]*bitfinex.BookUpdate, 0)
+	observed := ob.observers.active()
+	var previous map[levelKey]*bitfinex.BookUpdate
+	var bidBefore, askBefore *bitfinex.BookUpdate
+	if observed {
+		previous = ob.levels()
+		bidBefore, askBefore = ob.best(bitfinex.Bid), ob.best(bitfinex.Ask)
+	}
+
+	ob.bids.reset()
+	ob.asks.reset()
 	for _, order := range bs.Snapshot {
-    if (order.Side == bitfinex.Bid) {
-			ob.bids = append(ob.bids, order)
-		} else {
-			ob.asks = append(ob.asks, order)
+		side, sign := ob.side(order.Side)
+		side.set(levelKey{price: sign * order.Price}, order)
+	}
+	if !observed {
+		return nil
+	}
+	// diff the levels in book order, followed by the removed levels
+	changes := make([]LevelChange, 0)
+	ob.eachLevel(func(key levelKey, current *bitfinex.BookUpdate) {
+		if change, ok := levelChange(previous[key], current); ok {
+			changes = append(changes, change)
 		}
+		delete(previous, key)
+	})
+	removed := make([]LevelChange, 0, len(previous))
+	for _, bu := range previous {
+		change, _ := levelChange(bu, nil)
+		removed = append(removed, change)
 	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].Side != removed[j].Side {
+			return removed[i].Side == bitfinex.Bid
+		}
+		return removed[i].Price < removed[j].Price
+	})
+	return ob.newBookEvent(true, append(changes, removed...), bidBefore, askBefore)
+}
+
+// eachLevel iterates over all levels of the book, bids first
+func (ob *Orderbook) eachLevel(fn func(key levelKey, bu *bitfinex.BookUpdate)) {
+	for _, side := range []*priceLevels{&ob.bids, &ob.asks} {
+		side.each(-1, func(entry interface{}) bool {
+			bu := entry.(*bitfinex.BookUpdate)
+			_, sign := ob.side(bu.Side)
+			fn(levelKey{price: sign * bu.Price}, bu)
+			return true
+		})
+	}
+}
+
+// levels maps the book's entries by their level key
+func (ob *Orderbook) levels() map[levelKey]*bitfinex.BookUpdate {
+	levels := make(map[levelKey]*bitfinex.BookUpdate, ob.bids.len()+ob.asks.len())
+	ob.eachLevel(func(key levelKey, bu *bitfinex.BookUpdate) {
+		levels[key] = bu
+	})
+	return levels
 }
 
 func (ob *Orderbook) UpdateWith(bu *bitfinex.BookUpdate) {
+	// observers are notified once the lock has been released
+	ob.observers.notify(ob.updateWith(bu))
+}
+
+func (ob *Orderbook) updateWith(bu *bitfinex.BookUpdate) *OrderbookEvent {
 	ob.lock.Lock()
 	defer ob.lock.Unlock()
 
-	side := &ob.asks
-	if (bu.Side == bitfinex.Bid) {
-		side = &ob.bids
+	side, sign := ob.side(bu.Side)
+	key := levelKey{price: sign * bu.Price}
+	observed := ob.observers.active()
+	var previous, bidBefore, askBefore *bitfinex.BookUpdate
+	if observed {
+		if entry := side.get(key); entry != nil {
+			previous = entry.(*bitfinex.BookUpdate)
+		}
+		bidBefore, askBefore = ob.best(bitfinex.Bid), ob.best(bitfinex.Ask)
 	}
 
-	// check if first in book
-	if (len(*side) == 0) {
-		*side = append(*side, bu)
-		return
+	var current *bitfinex.BookUpdate
+	if bu.Count <= 0 {
+		// delete if count is equal to zero
+		side.remove(key)
+	} else {
+		// add or overwrite the price level
+		side.set(key, bu)
+		current = bu
 	}
-
-	// match price level
-	for index, sOrder := range *side {
-		if (sOrder.Price == bu.Price) {
-			if (index+1 > len(*(side))) {
-				return
-			}
-			if (bu.Count <= 0) {
-				// delete if count is equal to zero
-				*side = append((*side)[:index], (*side)[index+1:]...)
-				return
-			} else {
-				// remove now and we will add in the code below
-				*side = append((*side)[:index], (*side)[index+1:]...)
-			}
-		}
+	if !observed {
+		return nil
 	}
-	*side = append(*side, bu)
-	// add to the orderbook and sort lowest to highest
-	sort.Slice(*side, func(i, j int) bool {
-		if (i >= len(*(side)) || j >= len(*(side))) {
-			return false
-		}
-		if bu.Side == bitfinex.Ask {
-			return (*side)[i].Price < (*side)[j].Price
-		} else {
-			return (*side)[i].Price > (*side)[j].Price
-		}
+	change, ok := levelChange(previous, current)
+	if !ok {
+		return nil
+	}
+	return ob.newBookEvent(false, []LevelChange{change}, bidBefore, askBefore)
+}
+
+func (ob *Orderbook) Checksum() uint32 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return bookChecksum(&ob.bids, &ob.asks, func(entry interface{}) (string, string) {
+		bu := entry.(*bitfinex.BookUpdate)
+		return bu.PriceJsNum.String(), bu.AmountJsNum.String()
 	})
 }
 
-func (ob *Orderbook) Checksum() (uint32) {
-	ob.lock.Lock()
-	defer ob.lock.Unlock()
-	var checksumItems []string
-	for i := 0; i < 25; i++ {
-		if len(ob.bids) > i {
+// bookChecksum calculates the crc32 checksum of the top book entries, alternating
+// bids and asks. Each entry is identified by its price (or rate), or by its order ID
+// in raw books, followed by its amount.
+func bookChecksum(bidLevels, askLevels *priceLevels, item func(entry interface{}) (string, string)) uint32 {
+	bids := make([]interface{}, 0, checksumDepth)
+	asks := make([]interface{}, 0, checksumDepth)
+	bidLevels.each(checksumDepth, func(entry interface{}) bool {
+		bids = append(bids, entry)
+		return true
+	})
+	askLevels.each(checksumDepth, func(entry interface{}) bool {
+		asks = append(asks, entry)
+		return true
+	})
+	checksumItems := make([]string, 0, 4*checksumDepth)
+	for i := 0; i < checksumDepth; i++ {
+		if len(bids) > i {
 			// append bid
-			checksumItems = append(checksumItems, (ob.bids)[i].PriceJsNum.String())
-			checksumItems = append(checksumItems, (ob.bids)[i].AmountJsNum.String())
+			id, amount := item(bids[i])
+			checksumItems = append(checksumItems, id, amount)
 		}
-		if len(ob.asks) > i {
+		if len(asks) > i {
 			// append ask
-			checksumItems = append(checksumItems, (ob.asks)[i].PriceJsNum.String())
-			checksumItems = append(checksumItems, (ob.asks)[i].AmountJsNum.String())
+			id, amount := item(asks[i])
+			checksumItems = append(checksumItems, id, amount)
 		}
 	}
 	checksumStrings := strings.Join(checksumItems, ":")
 	return crc32.ChecksumIEEE([]byte(checksumStrings))
 }
-
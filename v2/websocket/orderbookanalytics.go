@@ -0,0 +1,202 @@
+package websocket
+
+import (
+	"errors"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// orderbook analytics errors
+var (
+	ErrEmptyBookSide     = errors.New("orderbook side is empty")
+	ErrInsufficientDepth = errors.New("orderbook depth is insufficient")
+)
+
+// The analytics functions run under the book's read lock. Functions which take
+// a side operate on that side of the book: asks are consumed by buy orders,
+// bids by sell orders. Amounts are absolute values.
+
+// walk iterates the given side of the book from the best price
+func (ob *Orderbook) walk(s bitfinex.OrderSide, fn func(bu *bitfinex.BookUpdate) bool) {
+	side, _ := ob.side(s)
+	side.each(-1, func(entry interface{}) bool {
+		return fn(entry.(*bitfinex.BookUpdate))
+	})
+}
+
+func (ob *Orderbook) best(s bitfinex.OrderSide) *bitfinex.BookUpdate {
+	var best *bitfinex.BookUpdate
+	side, _ := ob.side(s)
+	side.each(1, func(entry interface{}) bool {
+		best = entry.(*bitfinex.BookUpdate)
+		return false
+	})
+	return best
+}
+
+// BestBid returns the highest bid.
+func (ob *Orderbook) BestBid() (bitfinex.BookUpdate, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if bid := ob.best(bitfinex.Bid); bid != nil {
+		return *bid, nil
+	}
+	return bitfinex.BookUpdate{}, ErrEmptyBookSide
+}
+
+// BestAsk returns the lowest ask.
+func (ob *Orderbook) BestAsk() (bitfinex.BookUpdate, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if ask := ob.best(bitfinex.Ask); ask != nil {
+		return *ask, nil
+	}
+	return bitfinex.BookUpdate{}, ErrEmptyBookSide
+}
+
+func (ob *Orderbook) top() (bid, ask *bitfinex.BookUpdate, err error) {
+	bid = ob.best(bitfinex.Bid)
+	ask = ob.best(bitfinex.Ask)
+	if bid == nil || ask == nil {
+		return nil, nil, ErrEmptyBookSide
+	}
+	return bid, ask, nil
+}
+
+// Mid returns the price between the best bid and the best ask.
+func (ob *Orderbook) Mid() (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	bid, ask, err := ob.top()
+	if err != nil {
+		return 0, err
+	}
+	return (bid.Price + ask.Price) / 2, nil
+}
+
+// Spread returns the difference between the best ask and the best bid.
+func (ob *Orderbook) Spread() (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	bid, ask, err := ob.top()
+	if err != nil {
+		return 0, err
+	}
+	return ask.Price - bid.Price, nil
+}
+
+// SpreadBps returns the spread in basis points of the mid price.
+func (ob *Orderbook) SpreadBps() (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	bid, ask, err := ob.top()
+	if err != nil {
+		return 0, err
+	}
+	mid := (bid.Price + ask.Price) / 2
+	return (ask.Price - bid.Price) / mid * 10000, nil
+}
+
+// DepthToPrice returns the cumulative amount of the side's levels priced at
+// or better than the given price.
+func (ob *Orderbook) DepthToPrice(side bitfinex.OrderSide, price float64) float64 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	depth := 0.0
+	ob.walk(side, func(bu *bitfinex.BookUpdate) bool {
+		if (side == bitfinex.Bid && bu.Price < price) || (side != bitfinex.Bid && bu.Price > price) {
+			return false
+		}
+		depth += bu.Amount
+		return true
+	})
+	return depth
+}
+
+// DepthToNotional returns the cumulative amount of the side's levels needed to
+// fill the given notional (price * amount) value.
+func (ob *Orderbook) DepthToNotional(side bitfinex.OrderSide, notional float64) (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	depth, remaining := 0.0, notional
+	ob.walk(side, func(bu *bitfinex.BookUpdate) bool {
+		levelNotional := bu.Price * bu.Amount
+		if levelNotional >= remaining {
+			depth += remaining / bu.Price
+			remaining = 0
+			return false
+		}
+		depth += bu.Amount
+		remaining -= levelNotional
+		return true
+	})
+	if remaining > 0 {
+		return depth, ErrInsufficientDepth
+	}
+	return depth, nil
+}
+
+// SweepCost returns the volume-weighted average price and the notional cost of
+// filling the given size against the side of the book.
+func (ob *Orderbook) SweepCost(side bitfinex.OrderSide, size float64) (avgPrice float64, notional float64, err error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	remaining := size
+	ob.walk(side, func(bu *bitfinex.BookUpdate) bool {
+		fill := bu.Amount
+		if fill > remaining {
+			fill = remaining
+		}
+		notional += fill * bu.Price
+		remaining -= fill
+		return remaining > 0
+	})
+	if remaining > 0 {
+		return 0, notional, ErrInsufficientDepth
+	}
+	if size <= 0 {
+		return 0, 0, nil
+	}
+	return notional / size, notional, nil
+}
+
+// PriceAtSize returns the price of the level at which the cumulative amount of
+// the side reaches the given size.
+func (ob *Orderbook) PriceAtSize(side bitfinex.OrderSide, size float64) (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	cumulative, price, found := 0.0, 0.0, false
+	ob.walk(side, func(bu *bitfinex.BookUpdate) bool {
+		cumulative += bu.Amount
+		if cumulative >= size {
+			price, found = bu.Price, true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return 0, ErrInsufficientDepth
+	}
+	return price, nil
+}
+
+// Imbalance returns (bids - asks) / (bids + asks) of the amounts in the top n
+// levels of both sides (all levels when n < 0), ranging from -1 (only asks) to
+// 1 (only bids).
+func (ob *Orderbook) Imbalance(levels int) (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	var bids, asks float64
+	ob.bids.each(levels, func(entry interface{}) bool {
+		bids += entry.(*bitfinex.BookUpdate).Amount
+		return true
+	})
+	ob.asks.each(levels, func(entry interface{}) bool {
+		asks += entry.(*bitfinex.BookUpdate).Amount
+		return true
+	})
+	if bids+asks == 0 {
+		return 0, ErrEmptyBookSide
+	}
+	return (bids - asks) / (bids + asks), nil
+}
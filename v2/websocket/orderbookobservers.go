@@ -0,0 +1,206 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// LevelChangeType describes how a price level was changed by a book update.
+type LevelChangeType int
+
+const (
+	LevelAdded   LevelChangeType = 0
+	LevelChanged LevelChangeType = 1
+	LevelRemoved LevelChangeType = 2
+)
+
+func (t LevelChangeType) String() string {
+	switch t {
+	case LevelAdded:
+		return "added"
+	case LevelChanged:
+		return "changed"
+	case LevelRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// LevelChange is a single price level diff. Previous is nil for added levels,
+// Current is nil for removed levels.
+type LevelChange struct {
+	Type     LevelChangeType
+	Side     bitfinex.OrderSide
+	Price    float64
+	Previous *bitfinex.BookUpdate
+	Current  *bitfinex.BookUpdate
+}
+
+// ChecksumResult is the outcome of a checksum verification of the book.
+type ChecksumResult struct {
+	Expected   uint32 // checksum sent by the API
+	Calculated uint32 // checksum of the local book
+	Valid      bool
+}
+
+// OrderbookEvent is delivered to observers after a snapshot or an update has
+// been applied to the book, or after the book's checksum has been verified.
+type OrderbookEvent struct {
+	Symbol   string
+	Snapshot bool // the book has been replaced by a snapshot
+	Changes  []LevelChange
+
+	// top of book after the change, nil when the side is empty
+	TopOfBookChanged bool
+	BestBid          *bitfinex.BookUpdate
+	BestAsk          *bitfinex.BookUpdate
+
+	// set for checksum verification events only
+	Checksum *ChecksumResult
+}
+
+type bookObserver struct {
+	callback func(ev *OrderbookEvent)
+	queue    *messageQueue
+}
+
+// bookObservers holds the observers of a book. The zero value has no observers.
+type bookObservers struct {
+	lock      sync.RWMutex
+	observers map[int]*bookObserver
+	nextID    int
+}
+
+func (o *bookObservers) add(observer *bookObserver) func() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.observers == nil {
+		o.observers = make(map[int]*bookObserver)
+	}
+	id := o.nextID
+	o.nextID++
+	o.observers[id] = observer
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			o.lock.Lock()
+			defer o.lock.Unlock()
+			delete(o.observers, id)
+			if observer.queue != nil {
+				observer.queue.close()
+			}
+		})
+	}
+}
+
+func (o *bookObservers) active() bool {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return len(o.observers) > 0
+}
+
+func (o *bookObservers) notify(ev *OrderbookEvent) {
+	if ev == nil {
+		return
+	}
+	// callbacks may remove observers, notify without holding the lock
+	o.lock.RLock()
+	observers := make([]*bookObserver, 0, len(o.observers))
+	for _, observer := range o.observers {
+		observers = append(observers, observer)
+	}
+	o.lock.RUnlock()
+	for _, observer := range observers {
+		if observer.callback != nil {
+			observer.callback(ev)
+			continue
+		}
+		observer.queue.push(ev, nil)
+	}
+}
+
+// Observe registers a callback which receives every change of the book. The
+// callback is invoked from the socket's read routine after the locks of the book
+// and the client have been released, so it may read the book and call the
+// client, but it should return quickly and must not wait for further messages of
+// the socket, i.e. with SubscribeAndWait. The returned function removes the
+// observer.
+func (ob *Orderbook) Observe(callback func(ev *OrderbookEvent)) (remove func()) {
+	return ob.observers.add(&bookObserver{callback: callback})
+}
+
+// ObserveChan registers a channel which receives every change of the book as an
+// *OrderbookEvent. The channel never blocks book updates: once its buffer is full
+// the oldest events are dropped and reported with a *MessageGap, after which the
+// book state should be re-read. The returned function removes the observer and
+// closes the channel.
+func (ob *Orderbook) ObserveChan(bufferSize int) (events <-chan interface{}, remove func()) {
+	queue := newMessageQueue(bufferSize, BackpressureDropOldest)
+	return queue.messages, ob.observers.add(&bookObserver{queue: queue})
+}
+
+// notifyChecksum reports the result of a checksum verification to the observers
+func (ob *Orderbook) notifyChecksum(expected, calculated uint32) {
+	if !ob.observers.active() {
+		return
+	}
+	ob.lock.RLock()
+	ev := &OrderbookEvent{
+		Symbol:  ob.symbol,
+		BestBid: copyBookUpdate(ob.best(bitfinex.Bid)),
+		BestAsk: copyBookUpdate(ob.best(bitfinex.Ask)),
+		Checksum: &ChecksumResult{
+			Expected:   expected,
+			Calculated: calculated,
+			Valid:      expected == calculated,
+		},
+	}
+	ob.lock.RUnlock()
+	ob.observers.notify(ev)
+}
+
+func copyBookUpdate(bu *bitfinex.BookUpdate) *bitfinex.BookUpdate {
+	if bu == nil {
+		return nil
+	}
+	cpy := *bu
+	return &cpy
+}
+
+// levelChange creates the diff between the previous and current state of a level,
+// returns false if the level did not change
+func levelChange(previous, current *bitfinex.BookUpdate) (LevelChange, bool) {
+	switch {
+	case previous == nil && current == nil:
+		return LevelChange{}, false
+	case previous == nil:
+		return LevelChange{Type: LevelAdded, Side: current.Side, Price: current.Price, Current: copyBookUpdate(current)}, true
+	case current == nil:
+		return LevelChange{Type: LevelRemoved, Side: previous.Side, Price: previous.Price, Previous: copyBookUpdate(previous)}, true
+	case sameLevel(previous, current):
+		return LevelChange{}, false
+	}
+	return LevelChange{Type: LevelChanged, Side: current.Side, Price: current.Price, Previous: copyBookUpdate(previous), Current: copyBookUpdate(current)}, true
+}
+
+func sameLevel(a, b *bitfinex.BookUpdate) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Price == b.Price && a.Count == b.Count && a.Amount == b.Amount && a.AmountJsNum == b.AmountJsNum
+}
+
+// newBookEvent completes the event with the current top of book. Must be called
+// while holding the book's lock.
+func (ob *Orderbook) newBookEvent(snapshot bool, changes []LevelChange, bidBefore, askBefore *bitfinex.BookUpdate) *OrderbookEvent {
+	bid, ask := ob.best(bitfinex.Bid), ob.best(bitfinex.Ask)
+	return &OrderbookEvent{
+		Symbol:           ob.symbol,
+		Snapshot:         snapshot,
+		Changes:          changes,
+		TopOfBookChanged: !sameLevel(bid, bidBefore) || !sameLevel(ask, askBefore),
+		BestBid:          copyBookUpdate(bid),
+		BestAsk:          copyBookUpdate(ask),
+	}
+}
@@ -3,6 +3,8 @@ package websocket
 import (
 	"github.com/op/go-logging"
 	"time"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
 )
 
 // Parameters defines adapter behavior.
@@ -10,18 +12,59 @@ type Parameters struct {
 	AutoReconnect          bool
 	ReconnectInterval      time.Duration
 	ReconnectAttempts      int
+	// ReconnectBackoff provides the delay before each reconnect attempt. The
+	// ReconnectInterval is used as a constant delay when no strategy is set.
+	ReconnectBackoff       BackoffStrategy
 	reconnectTry           int
+	// ConnectionLimiter throttles new connections, the platform limits how many
+	// connections can be opened per minute. Nil disables the limit.
+	ConnectionLimiter      ConnectionLimiter
 	ShutdownTimeout        time.Duration
 	CapacityPerConnection  int
+	// SocketSelector places subscriptions and sent messages on the sockets, the
+	// MostAvailableSelector is used if none is set.
+	SocketSelector         SocketSelector
 	Logger                 *logging.Logger
 
 	ResubscribeOnReconnect bool
 
 	HeartbeatTimeout       time.Duration
+	// HeartbeatEscalation is the number of stale channels on a socket which
+	// reconnect the socket instead of resubscribing the stale channel. A value
+	// of 1 reconnects on every heartbeat timeout.
+	HeartbeatEscalation    int
+	// PingInterval is the interval of the application level pings of each
+	// socket, which measure the latency and keep the connection alive. Zero
+	// disables pings.
+	PingInterval           time.Duration
+	// PongTimeout reconnects a socket which did not answer a ping in time.
+	// Zero disables the check.
+	PongTimeout            time.Duration
+	// Clock is updated with the server time of every pong. Share the clock of
+	// the rest client to combine their samples, a new clock is used if nil.
+	Clock                  *bitfinex.ServerClock
 	LogTransport           bool
 
 	URL                    string
 	ManageOrderbook        bool
+	// ManageAccountState maintains the AccountState from the authenticated
+	// channel, see Client.AccountState.
+	ManageAccountState     bool
+	// ChecksumPolicy decides how a managed book is resynchronized after a checksum
+	// mismatch. ChecksumReseed fetches snapshots from the BookSnapshotProvider,
+	// i.e. the BookService of the rest client.
+	ChecksumPolicy         ChecksumPolicy
+	BookSnapshotProvider   BookSnapshotProvider
+
+	// SequenceGapPolicy decides how to recover from gaps in the sequence numbers
+	// of the SEQ_ALL flag.
+	SequenceGapPolicy      SequenceGapPolicy
+
+	// ListenerBufferSize sets the buffer of the Listen() channel and of each
+	// subscription stream. ListenerPolicy decides what happens once a buffer
+	// is full; the drop policies use a buffer of at least 2 messages.
+	ListenerBufferSize     int
+	ListenerPolicy         BackpressurePolicy
 }
 
 func NewDefaultParameters() *Parameters {
@@ -31,12 +74,22 @@ func NewDefaultParameters() *Parameters {
 		ReconnectInterval:      time.Second * 3,
 		reconnectTry:           0,
 		ReconnectAttempts:      15,
+		ReconnectBackoff:       nil,
+		ConnectionLimiter:      NewConnectionRateLimiter(20, time.Minute),
 		URL:                    productionBaseURL,
 		ManageOrderbook:        false,
+		ManageAccountState:     false,
+		ChecksumPolicy:         ChecksumResubscribe,
+		SequenceGapPolicy:      SequenceGapNotify,
 		ShutdownTimeout:        time.Second * 5,
 		ResubscribeOnReconnect: true,
 		HeartbeatTimeout:       time.Second * 30,
+		HeartbeatEscalation:    3,
+		PingInterval:           time.Second * KEEP_ALIVE_TIMEOUT,
+		PongTimeout:            0,
 		LogTransport:           false,           // log transport send/recv
+		ListenerBufferSize:     0,
+		ListenerPolicy:         BackpressureBlock,
 		Logger:                 logging.MustGetLogger("bitfinex-ws"),
 	}
 }
@@ -0,0 +1,196 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// ErrPongTimeout is the disconnect reason of a socket which did not answer a
+// ping within the PongTimeout.
+var ErrPongTimeout = errors.New("no pong received within the pong timeout")
+
+// number of round trips kept for the rolling latency of a socket
+const latencySamples = 10
+
+// PingRequest is the application level ping, answered by a pong event with the
+// same cid.
+type PingRequest struct {
+	Event string `json:"event"`
+	Cid   int64  `json:"cid"`
+}
+
+// PongEvent answers a PingRequest, TS is the server time in milliseconds.
+type PongEvent struct {
+	Cid int64 `json:"cid"`
+	TS  int64 `json:"ts"`
+}
+
+// latencyTracker matches pongs to their pings and keeps the rolling round trip
+// time of a socket connection
+type latencyTracker struct {
+	lock    sync.Mutex
+	pending map[int64]time.Time // ping send time by cid
+	samples []time.Duration     // ring of the last round trips
+	next    int
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		pending: make(map[int64]time.Time),
+		samples: make([]time.Duration, 0, latencySamples),
+	}
+}
+
+func (l *latencyTracker) sent(cid int64, t time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// unanswered pings are kept for the pong timeout only, forget the oldest
+	// if pongs never arrive and the timeout is disabled
+	if len(l.pending) >= latencySamples {
+		oldest := cid
+		for id := range l.pending {
+			if id < oldest {
+				oldest = id
+			}
+		}
+		delete(l.pending, oldest)
+	}
+	l.pending[cid] = t
+}
+
+// received records the round trip of the ping, false if the cid is unknown
+func (l *latencyTracker) received(cid int64, t time.Time) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	sent, ok := l.pending[cid]
+	if !ok {
+		return 0, false
+	}
+	delete(l.pending, cid)
+	rtt := t.Sub(sent)
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, rtt)
+	} else {
+		l.samples[l.next] = rtt
+	}
+	l.next = (l.next + 1) % latencySamples
+	return rtt, true
+}
+
+func (l *latencyTracker) isPending(cid int64) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, ok := l.pending[cid]
+	return ok
+}
+
+// average returns the mean of the recorded round trips, false without samples
+func (l *latencyTracker) average() (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.samples) == 0 {
+		return 0, false
+	}
+	var sum time.Duration
+	for _, rtt := range l.samples {
+		sum += rtt
+	}
+	return sum / time.Duration(len(l.samples)), true
+}
+
+// pingTicker returns the channel which triggers the pings of a socket, nil if
+// pings are disabled
+func (c *Client) pingTicker() (<-chan time.Time, func()) {
+	if c.parameters.PingInterval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(c.parameters.PingInterval)
+	return ticker.C, ticker.Stop
+}
+
+// ping sends a ping on the socket and, with a PongTimeout, restarts the socket
+// if the pong does not arrive in time
+func (c *Client) ping(socket *Socket) {
+	cid := atomic.AddInt64(&c.pingCid, 1)
+	socket.latency.sent(cid, time.Now())
+	err := socket.Asynchronous.Send(context.Background(), &PingRequest{Event: EventPing, Cid: cid})
+	if err != nil {
+		c.log.Warningf("could not ping socket (id=%d): %s", socket.Id, err.Error())
+		return
+	}
+	if c.parameters.PongTimeout <= 0 {
+		return
+	}
+	time.AfterFunc(c.parameters.PongTimeout, func() {
+		if !socket.latency.isPending(cid) {
+			return
+		}
+		c.log.Warningf("socket (id=%d) did not answer ping %d within %s", socket.Id, cid, c.parameters.PongTimeout)
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		// the socket may have been replaced by a reconnect in the meantime
+		if current, ok := c.sockets[socket.Id]; ok && current == socket && socket.IsConnected && !c.terminal {
+			c.restartSocket(socket, ErrPongTimeout)
+		}
+	})
+}
+
+func (c *Client) handlePong(socketId SocketId, pong *PongEvent) {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return
+	}
+	received := time.Now()
+	if rtt, ok := socket.latency.received(pong.Cid, received); ok {
+		c.log.Debugf("socket (id=%d) round trip %s", socketId, rtt)
+		if pong.TS > 0 {
+			server := time.Unix(0, pong.TS*int64(time.Millisecond))
+			c.clock.Observe(server, time.Millisecond, received.Add(-rtt), received)
+		}
+	}
+}
+
+// Clock returns the server clock, which is synchronized with the pongs of the
+// application level pings.
+func (c *Client) Clock() *bitfinex.ServerClock {
+	return c.clock
+}
+
+// SocketLatency returns the rolling round trip time of the application level
+// pings of the socket, averaged over the last pongs of its current connection.
+func (c *Client) SocketLatency(socketId SocketId) (time.Duration, error) {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return 0, err
+	}
+	rtt, ok := socket.latency.average()
+	if !ok {
+		return 0, fmt.Errorf("no pong received on socket (id=%d)", socketId)
+	}
+	return rtt, nil
+}
+
+// Latency returns the rolling round trip time averaged over all sockets which
+// received a pong, zero if no pong was received yet.
+func (c *Client) Latency() time.Duration {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	var sum time.Duration
+	n := 0
+	for _, socket := range c.sockets {
+		if rtt, ok := socket.latency.average(); ok {
+			sum += rtt
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / time.Duration(n)
+}
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"math/rand"
+)
+
+const (
+	levelsMaxHeight   = 24   // supports ~4^24 price levels per side
+	levelsProbability = 0.25 // chance to promote a node to the next level
+)
+
+// levelKey orders book entries by price, and by order ID for entries of the
+// same price in raw books
+type levelKey struct {
+	price float64
+	id    int64
+}
+
+func (k levelKey) less(o levelKey) bool {
+	if k.price != o.price {
+		return k.price < o.price
+	}
+	return k.id < o.id
+}
+
+type levelNode struct {
+	key   levelKey
+	entry interface{}
+	next  []*levelNode
+}
+
+// priceLevels is a skip list of book entries (trading or funding book updates)
+// ordered by ascending key. Bids are
+// keyed by their negated price so both sides iterate best price first. Lookups,
+// inserts and deletes are O(log n), reading the top n entries is O(n).
+// The zero value is an empty list. priceLevels is not safe for concurrent use.
+type priceLevels struct {
+	head   levelNode
+	height int
+	length int
+	rnd    *rand.Rand
+}
+
+func (l *priceLevels) init() {
+	if l.head.next != nil {
+		return
+	}
+	l.head.next = make([]*levelNode, levelsMaxHeight)
+	l.height = 1
+	// levels only affect performance, a fixed seed keeps runs reproducible
+	l.rnd = rand.New(rand.NewSource(1))
+}
+
+func (l *priceLevels) randomHeight() int {
+	h := 1
+	for h < levelsMaxHeight && l.rnd.Float64() < levelsProbability {
+		h++
+	}
+	return h
+}
+
+// path collects the last node before key on every level
+func (l *priceLevels) path(key levelKey, update []*levelNode) *levelNode {
+	n := &l.head
+	for i := l.height - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].key.less(key) {
+			n = n.next[i]
+		}
+		update[i] = n
+	}
+	return n.next[0]
+}
+
+// set inserts the entry or replaces the entry stored with the same key
+func (l *priceLevels) set(key levelKey, entry interface{}) {
+	l.init()
+	var update [levelsMaxHeight]*levelNode
+	n := l.path(key, update[:])
+	if n != nil && n.key == key {
+		n.entry = entry
+		return
+	}
+	h := l.randomHeight()
+	if h > l.height {
+		for i := l.height; i < h; i++ {
+			update[i] = &l.head
+		}
+		l.height = h
+	}
+	n = &levelNode{key: key, entry: entry, next: make([]*levelNode, h)}
+	for i := 0; i < h; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	l.length++
+}
+
+// remove deletes the entry stored with the given key, if any
+func (l *priceLevels) remove(key levelKey) {
+	if l.head.next == nil {
+		return
+	}
+	var update [levelsMaxHeight]*levelNode
+	n := l.path(key, update[:])
+	if n == nil || n.key != key {
+		return
+	}
+	for i := 0; i < len(n.next); i++ {
+		update[i].next[i] = n.next[i]
+	}
+	for l.height > 1 && l.head.next[l.height-1] == nil {
+		l.height--
+	}
+	l.length--
+}
+
+// get returns the entry stored with the given key, or nil
+func (l *priceLevels) get(key levelKey) interface{} {
+	if l.head.next == nil {
+		return nil
+	}
+	var update [levelsMaxHeight]*levelNode
+	n := l.path(key, update[:])
+	if n == nil || n.key != key {
+		return nil
+	}
+	return n.entry
+}
+
+// each iterates over the first n entries in order, or all entries when n < 0.
+// Iteration stops when fn returns false.
+func (l *priceLevels) each(n int, fn func(entry interface{}) bool) {
+	if l.head.next == nil {
+		return
+	}
+	for node := l.head.next[0]; node != nil && n != 0; node = node.next[0] {
+		if !fn(node.entry) {
+			return
+		}
+		n--
+	}
+}
+
+func (l *priceLevels) len() int {
+	return l.length
+}
+
+func (l *priceLevels) reset() {
+	*l = priceLevels{}
+}
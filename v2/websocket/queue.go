@@ -0,0 +1,199 @@
+package websocket
+
+import (
+	"sync"
+)
+
+// BackpressurePolicy defines how messages are delivered to a consumer channel
+// which is not drained fast enough.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock blocks the socket read routine until the consumer
+	// accepts the message.
+	BackpressureBlock BackpressurePolicy = 0
+	// BackpressureDropOldest discards the oldest buffered message to make room
+	// for the new one.
+	BackpressureDropOldest BackpressurePolicy = 1
+	// BackpressureDropNewest discards the new message when the buffer is full.
+	BackpressureDropNewest BackpressurePolicy = 2
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	case BackpressureDropNewest:
+		return "drop-newest"
+	}
+	return "unknown"
+}
+
+// MessageGap is delivered in place of messages which have been dropped due to
+// backpressure. Consumers should treat any stateful data (books, order state)
+// as out of sync when they receive a gap.
+type MessageGap struct {
+	Dropped      uint64 // messages dropped since the last gap event
+	TotalDropped uint64 // messages dropped since the queue was created
+}
+
+// messageQueue delivers messages to a consumer channel according to a
+// backpressure policy.
+type messageQueue struct {
+	messages   chan interface{}
+	policy     BackpressurePolicy
+	lock       sync.Mutex
+	unreported uint64 // dropped but not yet reported with a gap event
+	dropped    uint64 // total dropped
+	closed     bool
+
+	// blocked pushes hold the read lock, close waits for them after closing done
+	sendLock  sync.RWMutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// minimum buffer size of the drop policies, leaving room to queue a gap event
+// ahead of the latest message
+const minDropBufferSize = 2
+
+func newMessageQueue(size int, policy BackpressurePolicy) *messageQueue {
+	if policy != BackpressureBlock && size < minDropBufferSize {
+		size = minDropBufferSize
+	}
+	return &messageQueue{
+		messages: make(chan interface{}, size),
+		policy:   policy,
+		done:     make(chan struct{}),
+	}
+}
+
+// push delivers the message to the consumer. With the blocking policy push
+// waits until the message is accepted or the quit channel is closed.
+func (q *messageQueue) push(msg interface{}, quit <-chan struct{}) {
+	if q.policy != BackpressureDropOldest && q.policy != BackpressureDropNewest {
+		q.sendLock.RLock()
+		defer q.sendLock.RUnlock()
+		select {
+		case <-q.done:
+			return
+		default:
+		}
+		select {
+		case q.messages <- msg:
+		case <-quit:
+		case <-q.done:
+		}
+		return
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return
+	}
+	q.flushGap()
+	if q.unreported == 0 {
+		select {
+		case q.messages <- msg:
+			return
+		default:
+		}
+	}
+	if q.policy == BackpressureDropNewest {
+		q.drop(1)
+		return
+	}
+	// make room by discarding the oldest buffered messages, report the gap
+	// ahead of the new message when there is space for both
+	q.popOldest()
+	q.flushGap()
+	select {
+	case q.messages <- msg:
+		return
+	default:
+	}
+	q.popOldest()
+	select {
+	case q.messages <- msg:
+	default:
+		// unbuffered consumer which is not ready
+		q.drop(1)
+	}
+}
+
+// offer delivers the message like push, but never blocks the caller. With the
+// blocking policy a message which is not accepted right away is delivered from
+// a separate routine, so it may arrive after later messages.
+func (q *messageQueue) offer(msg interface{}) {
+	if q.policy == BackpressureDropOldest || q.policy == BackpressureDropNewest {
+		q.push(msg, nil)
+		return
+	}
+	q.sendLock.RLock()
+	select {
+	case <-q.done:
+		q.sendLock.RUnlock()
+		return
+	default:
+	}
+	select {
+	case q.messages <- msg:
+		q.sendLock.RUnlock()
+		return
+	default:
+	}
+	q.sendLock.RUnlock()
+	go q.push(msg, nil)
+}
+
+func (q *messageQueue) popOldest() {
+	select {
+	case old := <-q.messages:
+		if gap, ok := old.(*MessageGap); ok {
+			// a discarded gap event is reported again with the next one
+			q.unreported += gap.Dropped
+			return
+		}
+		q.drop(1)
+	default:
+	}
+}
+
+func (q *messageQueue) drop(count uint64) {
+	q.unreported += count
+	q.dropped += count
+}
+
+func (q *messageQueue) flushGap() {
+	if q.unreported == 0 {
+		return
+	}
+	select {
+	case q.messages <- &MessageGap{Dropped: q.unreported, TotalDropped: q.dropped}:
+		q.unreported = 0
+	default:
+	}
+}
+
+// Dropped returns the total count of messages dropped due to backpressure.
+func (q *messageQueue) Dropped() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+func (q *messageQueue) close() {
+	q.closeOnce.Do(func() {
+		// release blocked pushes before closing the channel
+		close(q.done)
+		q.sendLock.Lock()
+		defer q.sendLock.Unlock()
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		q.closed = true
+		close(q.messages)
+	})
+}
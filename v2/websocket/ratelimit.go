@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionLimiter throttles the creation of new websocket connections, including
+// reconnects, to stay within the connection limit of the platform.
+type ConnectionLimiter interface {
+	// Reserve reserves a connection and returns zero, or returns how long to wait
+	// until the next connection may be opened without reserving it.
+	Reserve() time.Duration
+}
+
+// ConnectionRateLimiter allows a number of connections within a sliding period.
+type ConnectionRateLimiter struct {
+	Connections int
+	Period      time.Duration
+
+	lock   sync.Mutex
+	opened []time.Time
+}
+
+// NewConnectionRateLimiter creates a limiter which allows the given number of
+// connections per period.
+func NewConnectionRateLimiter(connections int, period time.Duration) *ConnectionRateLimiter {
+	return &ConnectionRateLimiter{
+		Connections: connections,
+		Period:      period,
+	}
+}
+
+// Reserve reserves a connection if less than Connections were opened within the
+// last Period, otherwise it returns the time until the oldest one expires.
+func (l *ConnectionRateLimiter) Reserve() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.Connections <= 0 {
+		return 0
+	}
+	now := time.Now()
+	// drop connections which left the period
+	expired := 0
+	for _, t := range l.opened {
+		if now.Sub(t) < l.Period {
+			break
+		}
+		expired++
+	}
+	l.opened = l.opened[expired:]
+	if len(l.opened) >= l.Connections {
+		return l.opened[0].Add(l.Period).Sub(now)
+	}
+	l.opened = append(l.opened, now)
+	return 0
+}
+
+// ConnectionThrottled is published when a new connection has to wait for the
+// ConnectionLimiter. A new socket is assigned its ID once the connection is
+// reserved, its SocketId is the ID it would get at the time of the event.
+type ConnectionThrottled struct {
+	SocketId SocketId
+	Delay    time.Duration // wait until the next attempt to reserve the connection
+	Queued   int           // connections waiting for the limiter, including this one
+}
+
+// SubscribeProgress is published by SubscribeMany whenever the requests planned
+// for a socket have been sent.
+type SubscribeProgress struct {
+	SocketId   SocketId
+	Subscribed int // requests sent so far
+	Total      int
+}
+
+// waitConnectionLimit blocks until the ConnectionLimiter allows a new connection
+func (c *Client) waitConnectionLimit(ctx context.Context, socketId SocketId) error {
+	limiter := c.parameters.ConnectionLimiter
+	if limiter == nil {
+		return nil
+	}
+	queued := atomic.AddInt32(&c.queuedConnections, 1)
+	defer atomic.AddInt32(&c.queuedConnections, -1)
+	for {
+		delay := limiter.Reserve()
+		if delay <= 0 {
+			return nil
+		}
+		c.log.Infof("socket (id=%d) connection throttled for %s", socketId, delay)
+		c.publishLifecycleEvent(&ConnectionThrottled{SocketId: socketId, Delay: delay, Queued: int(queued)})
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		queued = atomic.LoadInt32(&c.queuedConnections)
+	}
+}
@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/bitfinexcom/bitfinex-api-go/v2"
+)
+
+// RawOrderbook is an order-level book managed from a raw (R0) book subscription.
+// Raw book updates are keyed by order ID and remove an order with a price of 0.
+type RawOrderbook struct {
+	mismatchCounter
+	lock sync.RWMutex
+
+	symbol string
+	orders map[int64]*bitfinex.BookUpdate
+	bids   priceLevels // keyed by negated price and order ID, highest bid first
+	asks   priceLevels // keyed by price and order ID, lowest ask first
+}
+
+// RawPriceLevel aggregates the orders of a raw book at a single price.
+type RawPriceLevel struct {
+	Price      float64
+	PriceJsNum json.Number
+	Side       bitfinex.OrderSide
+	Amount     float64 // total amount of all orders at this price
+	Count      int64   // number of orders at this price
+	Orders     []bitfinex.BookUpdate
+}
+
+func newRawOrderbook(symbol string) *RawOrderbook {
+	return &RawOrderbook{
+		symbol: symbol,
+		orders: make(map[int64]*bitfinex.BookUpdate),
+	}
+}
+
+func (ob *RawOrderbook) Symbol() string {
+	return ob.symbol
+}
+
+func (ob *RawOrderbook) side(s bitfinex.OrderSide) (*priceLevels, float64) {
+	if s == bitfinex.Bid {
+		return &ob.bids, -1
+	}
+	return &ob.asks, 1
+}
+
+func (ob *RawOrderbook) key(bu *bitfinex.BookUpdate) (*priceLevels, levelKey) {
+	side, sign := ob.side(bu.Side)
+	return side, levelKey{price: sign * bu.Price, id: bu.ID}
+}
+
+// Asks returns all ask orders, ordered from the lowest price and by order ID.
+func (ob *RawOrderbook) Asks() []bitfinex.BookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.copyOrders(&ob.asks)
+}
+
+// Bids returns all bid orders, ordered from the highest price and by order ID.
+func (ob *RawOrderbook) Bids() []bitfinex.BookUpdate {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.copyOrders(&ob.bids)
+}
+
+// Order returns the order with the given ID.
+func (ob *RawOrderbook) Order(id int64) (bitfinex.BookUpdate, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if order, ok := ob.orders[id]; ok {
+		return *order, true
+	}
+	return bitfinex.BookUpdate{}, false
+}
+
+// AskLevels returns the best n ask price levels, or all levels when n < 0.
+func (ob *RawOrderbook) AskLevels(n int) []RawPriceLevel {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.aggregate(&ob.asks, n)
+}
+
+// BidLevels returns the best n bid price levels, or all levels when n < 0.
+func (ob *RawOrderbook) BidLevels(n int) []RawPriceLevel {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.aggregate(&ob.bids, n)
+}
+
+func (ob *RawOrderbook) copyOrders(side *priceLevels) []bitfinex.BookUpdate {
+	cpy := make([]bitfinex.BookUpdate, 0, side.len())
+	side.each(-1, func(entry interface{}) bool {
+		cpy = append(cpy, *entry.(*bitfinex.BookUpdate))
+		return true
+	})
+	return cpy
+}
+
+func (ob *RawOrderbook) aggregate(side *priceLevels, n int) []RawPriceLevel {
+	levels := make([]RawPriceLevel, 0)
+	if n == 0 {
+		return levels
+	}
+	side.each(-1, func(entry interface{}) bool {
+		bu := entry.(*bitfinex.BookUpdate)
+		last := len(levels) - 1
+		if last < 0 || levels[last].Price != bu.Price {
+			if len(levels) == n {
+				return false
+			}
+			levels = append(levels, RawPriceLevel{
+				Price:      bu.Price,
+				PriceJsNum: bu.PriceJsNum,
+				Side:       bu.Side,
+			})
+			last++
+		}
+		levels[last].Amount += bu.Amount
+		levels[last].Count++
+		levels[last].Orders = append(levels[last].Orders, *bu)
+		return true
+	})
+	return levels
+}
+
+func (ob *RawOrderbook) SetWithSnapshot(bs *bitfinex.BookUpdateSnapshot) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	ob.orders = make(map[int64]*bitfinex.BookUpdate)
+	ob.bids.reset()
+	ob.asks.reset()
+	for _, order := range bs.Snapshot {
+		ob.orders[order.ID] = order
+		side, key := ob.key(order)
+		side.set(key, order)
+	}
+}
+
+func (ob *RawOrderbook) UpdateWith(bu *bitfinex.BookUpdate) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	// drop the previous state of the order, its price may have changed
+	if existing, ok := ob.orders[bu.ID]; ok {
+		side, key := ob.key(existing)
+		side.remove(key)
+		delete(ob.orders, bu.ID)
+	}
+	if bu.Action == bitfinex.BookRemoveEntry {
+		return
+	}
+	ob.orders[bu.ID] = bu
+	side, key := ob.key(bu)
+	side.set(key, bu)
+}
+
+// Checksum calculates the raw book checksum, which identifies the top orders
+// by their order ID instead of their price.
+func (ob *RawOrderbook) Checksum() uint32 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return bookChecksum(&ob.bids, &ob.asks, func(entry interface{}) (string, string) {
+		bu := entry.(*bitfinex.BookUpdate)
+		return strconv.FormatInt(bu.ID, 10), bu.AmountJsNum.String()
+	})
+}
@@ -0,0 +1,222 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// SocketState describes a socket to a SocketSelector.
+type SocketState struct {
+	Id            SocketId
+	Connected     bool
+	Capacity      int  // free channels of the socket
+	Subscriptions int  // channels of the socket, including pending subscriptions
+	Authenticated bool // carries the authenticated channel, also while authentication is pending
+}
+
+// maximum new connections opened for a single subscription while the
+// SocketSelector declines, the platform limit of new connections per minute
+const maxSelectorDeclines = 20
+
+// SocketSelector decides how subscriptions and traffic land on the sockets of the
+// client. The sockets are passed ordered by their Id.
+type SocketSelector interface {
+	// Subscription selects the socket of a new subscription. Declining (ok false)
+	// opens a new connection and asks again, so a selector must accept a socket
+	// without subscriptions. The subscription fails once the selector declined
+	// 20 new connections.
+	Subscription(req *SubscriptionRequest, sockets []SocketState) (id SocketId, ok bool)
+	// Send selects the socket for messages sent with Client.Send.
+	Send(sockets []SocketState) (id SocketId, ok bool)
+}
+
+// MostAvailableSelector subscribes on the socket with the most free capacity. A
+// new connection is opened once at most one channel is free across all sockets.
+type MostAvailableSelector struct{}
+
+// Subscription selects the socket with the most free capacity.
+func (s *MostAvailableSelector) Subscription(req *SubscriptionRequest, sockets []SocketState) (SocketId, bool) {
+	total := 0
+	fresh := false
+	for _, socket := range sockets {
+		total += socket.Capacity
+		fresh = fresh || socket.Subscriptions == 0
+	}
+	if len(sockets) == 0 || (total <= 1 && !fresh) {
+		return 0, false
+	}
+	best := sockets[0]
+	for _, socket := range sockets[1:] {
+		if socket.Capacity > best.Capacity {
+			best = socket
+		}
+	}
+	return best.Id, true
+}
+
+// Send selects the first socket.
+func (s *MostAvailableSelector) Send(sockets []SocketState) (SocketId, bool) {
+	if len(sockets) == 0 {
+		return 0, false
+	}
+	return sockets[0].Id, true
+}
+
+// SymbolHashSelector spreads subscriptions over a fixed number of connections by
+// the hash of their symbol, so a symbol always lands on the same connection.
+// Subscriptions fall back to the most available socket once their socket is full.
+type SymbolHashSelector struct {
+	Connections int
+}
+
+// Subscription selects the socket by the symbol hash, opening connections until
+// Connections sockets exist.
+func (s *SymbolHashSelector) Subscription(req *SubscriptionRequest, sockets []SocketState) (SocketId, bool) {
+	if len(sockets) < s.Connections {
+		return 0, false
+	}
+	n := s.Connections
+	if n <= 0 || n > len(sockets) {
+		n = len(sockets)
+	}
+	if n == 0 {
+		return 0, false
+	}
+	symbol := req.Symbol
+	if symbol == "" {
+		symbol = req.Key
+	}
+	h := fnv.New32a()
+	h.Write([]byte(symbol)) // nolint:errcheck
+	target := sockets[int(h.Sum32()%uint32(n))]
+	if target.Capacity > 0 {
+		return target.Id, true
+	}
+	return (&MostAvailableSelector{}).Subscription(req, sockets)
+}
+
+// Send selects the first socket.
+func (s *SymbolHashSelector) Send(sockets []SocketState) (SocketId, bool) {
+	return (&MostAvailableSelector{}).Send(sockets)
+}
+
+// PublicOffAuthSelector keeps public subscriptions off the authenticated socket,
+// so order traffic never queues behind public data. Public subscriptions and
+// sends are placed on the remaining sockets by the Selector, the
+// MostAvailableSelector if none is set.
+type PublicOffAuthSelector struct {
+	Selector SocketSelector
+}
+
+func (s *PublicOffAuthSelector) selector() SocketSelector {
+	if s.Selector != nil {
+		return s.Selector
+	}
+	return &MostAvailableSelector{}
+}
+
+func unauthenticated(sockets []SocketState) []SocketState {
+	public := make([]SocketState, 0, len(sockets))
+	for _, socket := range sockets {
+		if !socket.Authenticated {
+			public = append(public, socket)
+		}
+	}
+	return public
+}
+
+// Subscription selects one of the unauthenticated sockets.
+func (s *PublicOffAuthSelector) Subscription(req *SubscriptionRequest, sockets []SocketState) (SocketId, bool) {
+	return s.selector().Subscription(req, unauthenticated(sockets))
+}
+
+// Send selects one of the unauthenticated sockets, or the authenticated socket
+// if it is the only one.
+func (s *PublicOffAuthSelector) Send(sockets []SocketState) (SocketId, bool) {
+	if public := unauthenticated(sockets); len(public) > 0 {
+		return s.selector().Send(public)
+	}
+	return s.selector().Send(sockets)
+}
+
+func (c *Client) socketSelector() SocketSelector {
+	if c.parameters.SocketSelector != nil {
+		return c.parameters.SocketSelector
+	}
+	return &MostAvailableSelector{}
+}
+
+// socketStates returns the state of all sockets ordered by their Id
+func (c *Client) socketStates() []SocketState {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	states := make([]SocketState, 0, len(c.sockets))
+	for _, socket := range c.sockets {
+		state := SocketState{
+			Id:            socket.Id,
+			Connected:     socket.IsConnected,
+			Capacity:      c.parameters.CapacityPerConnection,
+			Authenticated: socket.IsAuthenticated,
+		}
+		if subs, err := c.subscriptions.lookupBySocketId(socket.Id); err == nil {
+			state.Subscriptions = subs.Len()
+			state.Capacity -= subs.Len()
+			for _, sub := range *subs {
+				if sub.Request.Event == "auth" {
+					state.Authenticated = true
+				}
+			}
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Id < states[j].Id })
+	return states
+}
+
+// selectSubscriptionSocket returns the socket selected for the subscription,
+// new connections are opened while the selector declines
+func (c *Client) selectSubscriptionSocket(ctx context.Context, req *SubscriptionRequest) (*Socket, error) {
+	selector := c.socketSelector()
+	for declines := 0; ; declines++ {
+		if id, ok := selector.Subscription(req, c.socketStates()); ok {
+			return c.socketById(id)
+		}
+		if declines == maxSelectorDeclines {
+			return nil, errSelectorDeclined(req)
+		}
+		if _, err := c.startNewConnection(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func errSelectorDeclined(req *SubscriptionRequest) error {
+	return fmt.Errorf("socket selector declined %d new connections for %s", maxSelectorDeclines, req.String())
+}
+
+// selectSendSocket returns the socket selected for generic messages
+func (c *Client) selectSendSocket() (*Socket, error) {
+	id, ok := c.socketSelector().Send(c.socketStates())
+	if !ok {
+		return nil, fmt.Errorf("no socket found")
+	}
+	return c.socketById(id)
+}
+
+// SubscribeOnSocket pins the subscription to the given socket, bypassing the
+// SocketSelector. The subscription stays on the socket across reconnects.
+func (c *Client) SubscribeOnSocket(ctx context.Context, socketId SocketId, req *SubscriptionRequest) (string, error) {
+	if c.InMaintenance() {
+		return "", ErrMaintenance
+	}
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return "", err
+	}
+	if req.SubID == "" {
+		req.SubID = c.nonce.GetNonce()
+	}
+	return c.subscribeBySocket(ctx, socket, req, nil)
+}
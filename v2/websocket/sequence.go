@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// SequenceGapPolicy defines how the client recovers from a sequence gap.
+type SequenceGapPolicy int
+
+const (
+	// SequenceGapNotify only publishes a SequenceGap event.
+	SequenceGapNotify SequenceGapPolicy = 0
+	// SequenceGapResync resubscribes all public channels of the socket after a
+	// public gap, and re-authenticates after a private gap, so fresh snapshots
+	// are received.
+	SequenceGapResync SequenceGapPolicy = 1
+)
+
+func (p SequenceGapPolicy) String() string {
+	switch p {
+	case SequenceGapNotify:
+		return "notify"
+	case SequenceGapResync:
+		return "resync"
+	}
+	return "unknown"
+}
+
+// SequenceGap is published when the sequence numbers added by the SEQ_ALL flag
+// show that messages were lost, duplicated or reordered.
+type SequenceGap struct {
+	SocketId SocketId
+	Private  bool  // gap in the sequence of the authenticated channel
+	Expected int64 // next expected sequence number
+	Received int64
+	Policy   SequenceGapPolicy // recovery applied to the socket
+}
+
+// sequenceNumbers extracts the sequence numbers which the SEQ_ALL flag appends
+// to a channel message, after the message data and before the timestamp of the
+// TIMESTAMP flag:
+//
+//	public:  [CHAN_ID, (TYPE,) DATA, SEQ]
+//	private: [0, TYPE, DATA, SEQ, AUTH_SEQ]
+//	request notifications carry no public sequence: [0, "n", DATA, AUTH_SEQ]
+//	heartbeats only carry the public sequence: [CHAN_ID, "hb", SEQ]
+func sequenceNumbers(raw []interface{}, private bool) (seq, authSeq int64) {
+	dataIdx := 1
+	if typ, ok := raw[1].(string); ok && typ != "hb" {
+		dataIdx = 2
+	}
+	number := func(i int) int64 {
+		if i < len(raw) {
+			if f, ok := raw[i].(float64); ok {
+				return int64(f)
+			}
+		}
+		return 0
+	}
+	if !private || dataIdx == 1 {
+		return number(dataIdx + 1), 0
+	}
+	if raw[1] == "n" && isRequestNotification(raw[2]) {
+		return 0, number(dataIdx + 1)
+	}
+	return number(dataIdx + 1), number(dataIdx + 2)
+}
+
+func isRequestNotification(data interface{}) bool {
+	if n, ok := data.([]interface{}); ok && len(n) > 1 {
+		if typ, ok := n[1].(string); ok {
+			return strings.HasSuffix(typ, "-req")
+		}
+	}
+	return false
+}
+
+// checkSequence verifies the sequence numbers of the message against the last
+// numbers received on the socket
+func (c *Client) checkSequence(socketId SocketId, raw []interface{}, private bool) {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return
+	}
+	seq, authSeq := sequenceNumbers(raw, private)
+	if seq != 0 {
+		if socket.pubSeq != 0 && seq != socket.pubSeq+1 {
+			c.handleSequenceGap(socket, false, socket.pubSeq+1, seq)
+		}
+		socket.pubSeq = seq
+	}
+	if authSeq != 0 {
+		if socket.authSeq != 0 && authSeq != socket.authSeq+1 {
+			c.handleSequenceGap(socket, true, socket.authSeq+1, authSeq)
+		}
+		socket.authSeq = authSeq
+	}
+}
+
+// resetSequences restarts the sequence tracking, i.e. for a (re)opened socket
+func (s *Socket) resetSequences() {
+	s.pubSeq = 0
+	s.authSeq = 0
+}
+
+func (c *Client) handleSequenceGap(socket *Socket, private bool, expected, received int64) {
+	c.log.Warningf("socket (id=%d) sequence gap, expected %d but got %d (private=%t)", socket.Id, expected, received, private)
+	c.publish(&SequenceGap{
+		SocketId: socket.Id,
+		Private:  private,
+		Expected: expected,
+		Received: received,
+		Policy:   c.parameters.SequenceGapPolicy,
+	})
+	if c.parameters.SequenceGapPolicy != SequenceGapResync {
+		return
+	}
+	if private {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		if err := c.Reauthenticate(ctx, c.getAuthFilters()...); err != nil {
+			c.log.Errorf("could not re-authenticate after sequence gap: %s", err.Error())
+		}
+		return
+	}
+	c.resubscribePublic(socket.Id)
+}
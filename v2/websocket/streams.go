@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SubscriptionStream delivers the snapshots and updates of a single subscription,
+// either on its own channel or to a callback. Messages routed to a stream are not
+// published on the client's Listen() channel; subscription events (subscribed,
+// unsubscribed, errors) still are.
+type SubscriptionStream struct {
+	client   *Client
+	lock     sync.RWMutex
+	request  *SubscriptionRequest
+	messages *messageQueue
+	callback func(msg interface{})
+	quit     chan struct{}
+	closed   bool
+	once     sync.Once
+}
+
+func newSubscriptionStream(c *Client, bufferSize int, callback func(msg interface{})) *SubscriptionStream {
+	s := &SubscriptionStream{
+		client:   c,
+		callback: callback,
+		quit:     make(chan struct{}),
+	}
+	if callback == nil {
+		s.messages = newMessageQueue(bufferSize, c.parameters.ListenerPolicy)
+	}
+	return s
+}
+
+// Listen returns the channel carrying the subscription's data. The channel is
+// closed once the subscription is removed. Streams created with a callback
+// return a nil channel.
+func (s *SubscriptionStream) Listen() <-chan interface{} {
+	if s.messages == nil {
+		return nil
+	}
+	return s.messages.messages
+}
+
+// DroppedMessages returns the count of messages which were not delivered to
+// the stream due to the configured ListenerPolicy.
+func (s *SubscriptionStream) DroppedMessages() uint64 {
+	if s.messages == nil {
+		return 0
+	}
+	return s.messages.Dropped()
+}
+
+// SubID returns the current subscription ID of the stream. The ID changes
+// when the subscription is re-established after a reconnect.
+func (s *SubscriptionStream) SubID() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.request.SubID
+}
+
+// Request returns the subscription request which backs the stream.
+func (s *SubscriptionStream) Request() *SubscriptionRequest {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.request
+}
+
+// Unsubscribe sends an unsubscribe request for the stream's subscription. The
+// stream is closed when the API acknowledges the request.
+func (s *SubscriptionStream) Unsubscribe(ctx context.Context) error {
+	return s.client.Unsubscribe(ctx, s.SubID())
+}
+
+// Done returns a channel which is closed when the stream is closed.
+func (s *SubscriptionStream) Done() <-chan struct{} {
+	return s.quit
+}
+
+func (s *SubscriptionStream) setRequest(req *SubscriptionRequest) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.request = req
+}
+
+// owns checks if the given request is the one currently backing the stream
+func (s *SubscriptionStream) owns(req *SubscriptionRequest) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.request == req
+}
+
+func (s *SubscriptionStream) deliver(msg interface{}) {
+	s.lock.RLock()
+	if s.closed {
+		s.lock.RUnlock()
+		return
+	}
+	if callback := s.callback; callback != nil {
+		// the callback may unsubscribe or close the client, which closes the
+		// stream under the write lock
+		s.lock.RUnlock()
+		callback(msg)
+		return
+	}
+	defer s.lock.RUnlock()
+	s.messages.push(msg, s.quit)
+}
+
+func (s *SubscriptionStream) close() {
+	s.once.Do(func() {
+		// release any blocked delivery before taking the write lock
+		close(s.quit)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.closed = true
+		if s.messages != nil {
+			s.messages.close()
+		}
+	})
+}
+
+// SubscribeStream submits the given subscription request and returns a stream
+// which only carries the data of this subscription. The stream channel is
+// buffered with the given size and follows the client's ListenerPolicy.
+func (c *Client) SubscribeStream(ctx context.Context, req *SubscriptionRequest, bufferSize int) (*SubscriptionStream, error) {
+	if bufferSize < 0 {
+		return nil, fmt.Errorf("negative stream buffer size not supported: %d", bufferSize)
+	}
+	stream := newSubscriptionStream(c, bufferSize, nil)
+	_, err := c.subscribe(ctx, req, stream)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// SubscribeFunc submits the given subscription request and invokes the callback
+// for every snapshot and update of this subscription. The callback is invoked
+// from the socket's read routine, so it should return quickly.
+func (c *Client) SubscribeFunc(ctx context.Context, req *SubscriptionRequest, callback func(msg interface{})) (*SubscriptionStream, error) {
+	if callback == nil {
+		return nil, fmt.Errorf("stream callback must not be nil")
+	}
+	stream := newSubscriptionStream(c, 0, callback)
+	_, err := c.subscribe(ctx, req, stream)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// publishSubscriptionData routes subscription data to its stream, or to the client listener
+// when the subscription has no stream attached
+func (c *Client) publishSubscriptionData(sub *subscription, msg interface{}) {
+	if sub.stream != nil {
+		sub.stream.deliver(msg)
+		return
+	}
+	c.publish(msg)
+}
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+)
+
+type subscribeAck struct {
+	event *SubscribeEvent
+	err   error
+}
+
+// pendingSubscriptions correlates subscribe requests with the subscribed or
+// error event sent in response, by subscription ID.
+type pendingSubscriptions struct {
+	lock    sync.Mutex
+	waiters map[string]chan subscribeAck
+}
+
+func newPendingSubscriptions() *pendingSubscriptions {
+	return &pendingSubscriptions{
+		waiters: make(map[string]chan subscribeAck),
+	}
+}
+
+// add registers a waiter for the subscription ID. The returned channel receives
+// at most one ack.
+func (p *pendingSubscriptions) add(subID string) chan subscribeAck {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	ch := make(chan subscribeAck, 1)
+	p.waiters[subID] = ch
+	return ch
+}
+
+func (p *pendingSubscriptions) remove(subID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.waiters, subID)
+}
+
+// resolve delivers the ack to the waiter of the subscription ID, if any
+func (p *pendingSubscriptions) resolve(subID string, event *SubscribeEvent, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if ch, ok := p.waiters[subID]; ok {
+		ch <- subscribeAck{event: event, err: err}
+		delete(p.waiters, subID)
+	}
+}
+
+// SubscribeAndWait submits the subscription request and blocks until the API
+// acknowledged it with a subscribed event, which carries the channel ID. A
+// rejected subscription returns an *EventError, which can be matched with
+// errors.Is, i.e. errors.Is(err, ErrUnknownPair). Error events without a
+// subscription ID can not be matched, the request then ends with the context.
+func (c *Client) SubscribeAndWait(ctx context.Context, req *SubscriptionRequest) (*SubscribeEvent, error) {
+	if req.SubID == "" {
+		req.SubID = c.nonce.GetNonce()
+	}
+	// register before sending so a fast response can not be missed
+	ch := c.pendingSubs.add(req.SubID)
+	if _, err := c.Subscribe(ctx, req); err != nil {
+		c.pendingSubs.remove(req.SubID)
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		c.pendingSubs.remove(req.SubID)
+		return nil, ctx.Err()
+	case ack := <-ch:
+		return ack.event, ack.err
+	}
+}
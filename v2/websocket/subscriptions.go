@@ -32,6 +32,32 @@ type SubscriptionRequest struct {
 
 const MaxChannels = 25
 
+// Authenticated channel filters, see AuthFilter
+const (
+	FilterTrading = "trading" // orders, positions, trades
+	FilterFunding = "funding" // offers, credits, loans, funding trades
+	FilterWallet  = "wallet"  // wallets
+	FilterAlgo    = "algo"    // algorithmic orders
+	FilterBalance = "balance" // balance and margin info
+	FilterNotify  = "notify"  // notifications
+)
+
+// FilterTradingSymbol restricts the trading messages to a symbol, i.e. tBTCUSD.
+func FilterTradingSymbol(symbol string) string {
+	return FilterTrading + "-" + symbol
+}
+
+// FilterFundingSymbol restricts the funding messages to a symbol, i.e. fUSD.
+func FilterFundingSymbol(symbol string) string {
+	return FilterFunding + "-" + symbol
+}
+
+// FilterWalletCurrency restricts the wallet messages to a wallet, i.e. exchange
+// and BTC.
+func FilterWalletCurrency(walletType, currency string) string {
+	return FilterWallet + "-" + walletType + "-" + currency
+}
+
 func (s *SubscriptionRequest) String() string {
 	if s.Key == "" && s.Channel != "" && s.Symbol != "" {
 		return fmt.Sprintf("%s %s", s.Channel, s.Symbol)
@@ -62,8 +88,13 @@ type subscription struct {
 	Public     bool
 
 	Request    *SubscriptionRequest
+	stream     *SubscriptionStream
+
+	// set once the first snapshot was received, later lists of updates are bulk updates
+	snapshotReceived bool
 
 	hbDeadline time.Time
+	hbStale    bool // missed the heartbeat deadline, recovery is in progress
 }
 
 func isPublic(request *SubscriptionRequest) bool {
@@ -82,11 +113,12 @@ func isPublic(request *SubscriptionRequest) bool {
 	return false
 }
 
-func newSubscription(socketId SocketId, request *SubscriptionRequest) *subscription {
+func newSubscription(socketId SocketId, request *SubscriptionRequest, stream *SubscriptionStream) *subscription {
 	return &subscription{
 		ChanID:  -1,
 		SocketId: socketId,
 		Request: request,
+		stream:  stream,
 		pending: true,
 		Public:  isPublic(request),
 	}
@@ -183,19 +215,21 @@ func (s *subscriptions) heartbeat(chanID int64) {
 	defer s.lock.Unlock()
 	if sub, ok := s.subsByChanID[chanID]; ok {
 		sub.hbDeadline = time.Now().Add(s.hbTimeout)
+		sub.hbStale = false
 	}
 }
 
 func (s *subscriptions) sweep(exp time.Time) {
-	s.lock.RLock()
+	s.lock.Lock()
 	if !s.hbActive {
-		s.lock.RUnlock()
+		s.lock.Unlock()
 		return
 	}
 	disconnects := make([]HeartbeatDisconnect, 0)
 	for _, sub := range s.subsByChanID {
-		if exp.After(sub.hbDeadline) {
-			s.hbActive = false
+		// stale channels are reported once, until a heartbeat is received again
+		if !sub.hbStale && exp.After(sub.hbDeadline) {
+			sub.hbStale = true
 			hbErr := HeartbeatDisconnect{
 				Subscription: sub,
 				Error: fmt.Errorf("heartbeat disconnect on channel %d expired at %s (%s timeout)", sub.ChanID, sub.hbDeadline, s.hbTimeout),
@@ -203,7 +237,7 @@ func (s *subscriptions) sweep(exp time.Time) {
 			disconnects = append(disconnects, hbErr)
 		}
 	}
-	s.lock.RUnlock()
+	s.lock.Unlock()
 	for _, dis := range disconnects {
 		s.hbDisconnect <- dis
 	}
@@ -223,6 +257,13 @@ func (s *subscriptions) control() {
 
 // Close is terminal. Do not call heartbeat after close.
 func (s *subscriptions) Close() {
+	s.lock.RLock()
+	for _, sub := range s.subsBySubID {
+		if sub.stream != nil {
+			sub.stream.close()
+		}
+	}
+	s.lock.RUnlock()
 	s.ResetAll()
 	close(s.hbShutdown)
 }
@@ -256,15 +297,32 @@ func (s *subscriptions) ResetAll() {
 	s.lock.Unlock()
 }
 
+// staleCount returns the number of channels of the socket which missed their
+// heartbeat deadline
+func (s *subscriptions) staleCount(socketId SocketId) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	stale := 0
+	for _, sub := range s.subsBySocketId[socketId] {
+		if sub.hbStale {
+			stale++
+		}
+	}
+	return stale
+}
+
 // ListenDisconnect returns an error channel which receives a message when a heartbeat has expired a channel.
 func (s *subscriptions) ListenDisconnect() <-chan HeartbeatDisconnect {
 	return s.hbDisconnect
 }
 
-func (s *subscriptions) add(socketId SocketId, sub *SubscriptionRequest) *subscription {
+func (s *subscriptions) add(socketId SocketId, sub *SubscriptionRequest, stream *SubscriptionStream) *subscription {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	subscription := newSubscription(socketId, sub)
+	subscription := newSubscription(socketId, sub, stream)
+	if stream != nil {
+		stream.setRequest(sub)
+	}
 	s.subsBySubID[sub.SubID] = subscription
 	if _, ok := s.subsBySocketId[socketId]; !ok {
 		s.subsBySocketId[socketId] = make(SubscriptionSet, 0)
@@ -273,13 +331,14 @@ func (s *subscriptions) add(socketId SocketId, sub *SubscriptionRequest) *subscr
 	return subscription
 }
 
-func (s *subscriptions) removeByChannelID(chanID int64) error {
+// removeByChannelID removes the subscription of the channel and returns it
+func (s *subscriptions) removeByChannelID(chanID int64) (*subscription, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	// remove from socketId map
 	sub, ok := s.subsByChanID[chanID]
 	if !ok {
-		return fmt.Errorf("could not find channel ID %d", chanID)
+		return nil, fmt.Errorf("could not find channel ID %d", chanID)
 	}
 	delete(s.subsByChanID, chanID)
 	delete(s.subsBySubID, sub.SubID())
@@ -287,7 +346,11 @@ func (s *subscriptions) removeByChannelID(chanID int64) error {
 	if _, ok := s.subsBySocketId[sub.SocketId]; ok {
 		s.subsBySocketId[sub.SocketId] = s.subsBySocketId[sub.SocketId].RemoveByChannelId(chanID)
 	}
-	return nil
+	// close the stream unless it has been handed over to a new subscription
+	if sub.stream != nil && sub.stream.owns(sub.Request) {
+		sub.stream.close()
+	}
+	return sub, nil
 }
 
 // nolint:megacheck
@@ -308,6 +371,36 @@ func (s *subscriptions) removeBySubscriptionID(subID string) error {
 	return nil
 }
 
+// removePending removes a subscription which was rejected before it was activated
+// and returns it
+func (s *subscriptions) removePending(subID string) (*subscription, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sub, ok := s.subsBySubID[subID]
+	if !ok || !sub.pending {
+		return nil, false
+	}
+	// pending subscriptions are not indexed by channel ID yet
+	delete(s.subsBySubID, subID)
+	if _, ok := s.subsBySocketId[sub.SocketId]; ok {
+		s.subsBySocketId[sub.SocketId] = s.subsBySocketId[sub.SocketId].RemoveBySubscriptionId(subID)
+	}
+	return sub, true
+}
+
+// bookSubscribed returns true if a book subscription, active or pending, manages
+// the book of the given bookKey
+func (s *subscriptions) bookSubscribed(key string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, sub := range s.subsBySubID {
+		if sub.Request.Channel == ChanBook && bookKey(sub.Request) == key {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *subscriptions) activate(subID string, chanID int64) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -21,7 +21,7 @@ const WS_WRITE_CAPACITY = 5000
 // routine pushes websocket updates into
 const WS_READ_CAPACITY = 10
 // seconds to wait in between re-sending
-// the keep alive ping
+// the keep alive ping, the default PingInterval
 const KEEP_ALIVE_TIMEOUT = 10
 
 func newWs(baseURL string, logTransport bool, log *logging.Logger) *ws {
@@ -78,25 +78,11 @@ func (w *ws) Connect() error {
 	w.ws = ws
 	go w.listenWriteChannel()
 	go w.listenWs()
-	// Gorilla/go dont natively support keep alive pinging
-	// so we need to keep sending a message down the channel to stop
-	// tcp killing the connection
-	go w.keepAlivePinger()
+	// the client keeps the connection alive with application level pings,
+	// see Parameters.PingInterval
 	return nil
 }
 
-func (w *ws) keepAlivePinger() {
-	for {
-		pingTimer := time.After(time.Second * KEEP_ALIVE_TIMEOUT)
-		select {
-		case <-w.kill:
-			return
-		case <-pingTimer:
-			w.writeChan <- []byte("ping")
-		}
-	}
-}
-
 // Send marshals the given interface and then sends it to the API. This method
 // can block so specify a context with timeout if you don't want to wait for too
 // long.